@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/server"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+)
+
+// account is a Google identity that completed the OAuth flow, together with
+// the calendar backend acting on its behalf.
+type account struct {
+	ID      string // Google "sub" claim, stable across email changes
+	Email   string
+	Name    string
+	Scopes  []string // as granted by the user, which may be less than requested
+	Token   oauth2.TokenSource
+	Backend CalendarBackend
+
+	ServiceAccount bool // credentials come from a key file, not a user's consent
+	CalDAV         bool // a CalDAV server signed in with a password, without Token
+	Local          bool // local iCalendar files, without Token
+}
+
+// method describes how the server signs in as acct.
+func (acct *account) method() string {
+	switch {
+	case acct.ServiceAccount:
+		return "service account"
+	case acct.CalDAV:
+		return "CalDAV"
+	case acct.Local:
+		return "local files"
+	}
+	return "OAuth"
+}
+
+// configured reports whether acct comes from the server's configuration
+// rather than a user's consent, so it can be neither linked nor logged out.
+func (acct *account) configured() bool {
+	return acct.ServiceAccount || acct.CalDAV || acct.Local
+}
+
+// accountRegistry keeps linked Google accounts and which principal (the
+// caller: a verified bearer identity, or else the MCP session) may act as
+// which accounts. A principal may link several accounts, e.g. work and
+// personal; the first one linked is its default. Accounts outlive the
+// sessions bound to them so a returning user keeps their refresh token.
+type accountRegistry struct {
+	mu       sync.RWMutex
+	accounts map[string]*account // by account ID
+	bindings map[string][]string // principal -> account IDs, in link order
+	store    TokenStore          // nil keeps tokens in memory only
+	fallback *account            // acts for every principal without a binding
+}
+
+func newAccountRegistry(store TokenStore) *accountRegistry {
+	return &accountRegistry{
+		accounts: make(map[string]*account),
+		bindings: make(map[string][]string),
+		store:    store,
+	}
+}
+
+// newAccount builds the Calendar client for a Google identity from its OAuth
+// token. Whenever the token is refreshed the new one is written to the store.
+func (r *accountRegistry) newAccount(ctx context.Context, info *userInfo, token *oauth2.Token) (*account, error) {
+	acct := &account{ID: info.Sub, Email: info.Email, Name: info.Name}
+	acct.Token = &persistingTokenSource{
+		base: oauthConfig.TokenSource(ctx, token),
+		last: token,
+		persist: func(token *oauth2.Token) {
+			r.save(acct, token)
+		},
+	}
+	srv, err := calendar.NewService(ctx, calendarOptions(option.WithTokenSource(acct.Token))...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Calendar service: %w", err)
+	}
+	acct.Backend = newGoogleBackend(srv)
+	return acct, nil
+}
+
+// restore relinks every account found in the store, bound again to the
+// bearer identities that linked them. That only survives a restart with
+// MCP_AUTH_REQUIRED: MCP sessions end with the process, and nothing tells
+// which new session belongs to whom, so their accounts stay bound to no one
+// and users have to run auth again.
+func (r *accountRegistry) restore(ctx context.Context) error {
+	if r.store == nil {
+		return nil
+	}
+	records, err := r.store.LoadAll()
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		info := &userInfo{Sub: record.ID, Email: record.Email, Name: record.Name}
+		acct, err := r.newAccount(ctx, info, record.Token)
+		if err != nil {
+			return fmt.Errorf("unable to restore account %s: %w", record.Email, err)
+		}
+		acct.Scopes = record.Scopes
+		r.mu.Lock()
+		r.accounts[acct.ID] = acct
+		for _, principal := range record.Principals {
+			r.bindings[principal] = append(r.bindings[principal], acct.ID)
+		}
+		r.mu.Unlock()
+	}
+	log.Printf("Restored %d account(s) from token store", len(records))
+	return nil
+}
+
+// save writes the token of acct to the store, if there is one.
+func (r *accountRegistry) save(acct *account, token *oauth2.Token) {
+	if r.store == nil {
+		return
+	}
+	// Session principals die with the process; bearer identities come back
+	var principals []string
+	r.mu.RLock()
+	for principal, ids := range r.bindings {
+		if slices.Contains(ids, acct.ID) && strings.HasPrefix(principal, bearerPrincipalPrefix) {
+			principals = append(principals, principal)
+		}
+	}
+	r.mu.RUnlock()
+
+	err := r.store.Save(&storedAccount{
+		ID:         acct.ID,
+		Email:      acct.Email,
+		Name:       acct.Name,
+		Scopes:     acct.Scopes,
+		Principals: principals,
+		Token:      token,
+	})
+	if err != nil {
+		log.Printf("Unable to persist token of %s: %v", acct.Email, err)
+	}
+}
+
+// flush writes the latest token of every linked account to the store, if
+// there is one, along with the principals bound to it now.
+func (r *accountRegistry) flush() {
+	if r.store == nil {
+		return
+	}
+	r.mu.RLock()
+	accts := slices.Collect(maps.Values(r.accounts))
+	r.mu.RUnlock()
+
+	for _, acct := range accts {
+		if source, ok := acct.Token.(*persistingTokenSource); ok {
+			if token := source.latest(); token != nil {
+				r.save(acct, token)
+			}
+		}
+	}
+	log.Printf("Flushed %d account(s) to token store", len(accts))
+}
+
+// get returns the linked account with the given ID, or nil.
+func (r *accountRegistry) get(id string) *account {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.accounts[id]
+}
+
+// link stores acct, replacing any previous credentials for the same Google
+// identity, and binds it to principal in addition to the accounts principal
+// already linked.
+func (r *accountRegistry) link(principal string, acct *account) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.accounts[acct.ID] = acct
+	if !slices.Contains(r.bindings[principal], acct.ID) {
+		r.bindings[principal] = append(r.bindings[principal], acct.ID)
+	}
+}
+
+// remove unlinks the account with the given ID: every principal bound to it
+// loses access and its stored token is deleted.
+func (r *accountRegistry) remove(id string) {
+	r.mu.Lock()
+	delete(r.accounts, id)
+	for principal, ids := range r.bindings {
+		ids = slices.DeleteFunc(ids, func(boundID string) bool { return boundID == id })
+		if len(ids) == 0 {
+			delete(r.bindings, principal)
+		} else {
+			r.bindings[principal] = ids
+		}
+	}
+	r.mu.Unlock()
+
+	if r.store != nil {
+		if err := r.store.Delete(id); err != nil {
+			log.Printf("Unable to delete stored token of %s: %v", id, err)
+		}
+	}
+}
+
+// unbind forgets which accounts principal acts as. The accounts themselves
+// stay linked.
+func (r *accountRegistry) unbind(principal string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.bindings, principal)
+}
+
+// setFallback makes acct act for every principal that has not linked an
+// account of its own, as in service-account mode.
+func (r *accountRegistry) setFallback(acct *account) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = acct
+}
+
+// fallbackAccount returns the account set with setFallback, or nil.
+func (r *accountRegistry) fallbackAccount() *account {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.fallback
+}
+
+// linked returns the accounts principal linked, default first. A bearer
+// identity that is itself a linked Google account acts as that account
+// without an explicit binding.
+func (r *accountRegistry) linked(principal string) []*account {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var linked []*account
+	if sub, ok := strings.CutPrefix(principal, bearerPrincipalPrefix); ok {
+		if acct, ok := r.accounts[sub]; ok {
+			linked = append(linked, acct)
+		}
+	}
+	for _, id := range r.bindings[principal] {
+		if acct, ok := r.accounts[id]; ok && !slices.Contains(linked, acct) {
+			linked = append(linked, acct)
+		}
+	}
+	return linked
+}
+
+// accountsFor returns the accounts principal may act as: the ones it linked,
+// or else the fallback account.
+func (r *accountRegistry) accountsFor(principal string) []*account {
+	if linked := r.linked(principal); len(linked) > 0 {
+		return linked
+	}
+	if fallback := r.fallbackAccount(); fallback != nil {
+		return []*account{fallback}
+	}
+	return nil
+}
+
+// forPrincipal returns the default account of principal, or nil.
+func (r *accountRegistry) forPrincipal(principal string) *account {
+	all := r.accountsFor(principal)
+	if len(all) == 0 {
+		return nil
+	}
+	return all[0]
+}
+
+// find returns the account of principal matching selector, an email address
+// or account ID.
+func (r *accountRegistry) find(principal, selector string) (*account, error) {
+	all := r.accountsFor(principal)
+	for _, acct := range all {
+		if strings.EqualFold(acct.Email, selector) || acct.ID == selector {
+			return acct, nil
+		}
+	}
+	return nil, fmt.Errorf("no linked account %q, linked accounts: %s", selector, accountEmails(all))
+}
+
+// accountEmails lists the email addresses of all for messages.
+func accountEmails(all []*account) string {
+	emails := make([]string, len(all))
+	for i, acct := range all {
+		emails[i] = acct.Email
+	}
+	return strings.Join(emails, ", ")
+}
+
+// accountEvent is an event together with the account it was read from, for
+// views merging several accounts.
+type accountEvent struct {
+	Account *account
+	Event   *Event
+}
+
+// sortEventsByStart orders events by start time. All-day events start at
+// midnight UTC of their date.
+func sortEventsByStart(events []accountEvent) {
+	slices.SortStableFunc(events, func(a, b accountEvent) int {
+		return a.Event.Start.Time.Compare(b.Event.Start.Time)
+	})
+}
+
+// principalFromContext identifies the caller of a tool: the verified bearer
+// identity when the MCP endpoints require authorization, otherwise the MCP
+// session. Credentials are scoped to it so concurrent users never share an
+// account.
+func principalFromContext(ctx context.Context) string {
+	if identity := bearerIdentityFromContext(ctx); identity != nil {
+		return bearerPrincipalPrefix + identity.Subject
+	}
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil {
+		return ""
+	}
+	return session.SessionID()
+}
+
+// persistingTokenSource hands out tokens from base and reports each new one
+// to persist, so refreshed access tokens reach the token store.
+type persistingTokenSource struct {
+	mu      sync.Mutex
+	base    oauth2.TokenSource
+	last    *oauth2.Token
+	persist func(*oauth2.Token)
+}
+
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, err := s.base.Token()
+	if err != nil {
+		return nil, err
+	}
+	if s.last == nil || token.AccessToken != s.last.AccessToken {
+		s.last = token
+		s.persist(token)
+	}
+	return token, nil
+}
+
+// latest returns the last token handed out, or nil.
+func (s *persistingTokenSource) latest() *oauth2.Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+type userInfo struct {
+	Sub   string `json:"sub"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// fetchUserInfo resolves the Google identity behind an authorized client
+// using the OpenID Connect userinfo endpoint.
+func fetchUserInfo(ctx context.Context, client *http.Client) (*userInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, googleUserInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("userinfo request failed: %s", resp.Status)
+	}
+
+	var info userInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+	if info.Sub == "" {
+		return nil, fmt.Errorf("userinfo response has no subject")
+	}
+	return &info, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestAccountRegistryIsolatesPrincipals(t *testing.T) {
+	r := newAccountRegistry(nil)
+	r.link("session-a", &account{ID: "alice", Email: "alice@example.com"})
+
+	if got := r.forPrincipal("session-a"); got == nil || got.ID != "alice" {
+		t.Fatalf("session-a: expected alice, got %+v", got)
+	}
+	if got := r.forPrincipal("session-b"); got != nil {
+		t.Fatalf("session-b: expected no account, got %+v", got)
+	}
+
+	r.link("session-b", &account{ID: "bob", Email: "bob@example.com"})
+	if got := r.forPrincipal("session-a"); got.ID != "alice" {
+		t.Fatalf("session-a: expected alice after bob linked, got %s", got.ID)
+	}
+
+	r.unbind("session-a")
+	if got := r.forPrincipal("session-a"); got != nil {
+		t.Fatalf("session-a: expected no account after unbind, got %+v", got)
+	}
+	if got := r.forPrincipal("session-b"); got == nil || got.ID != "bob" {
+		t.Fatalf("session-b: expected bob, got %+v", got)
+	}
+}
+
+func TestRestoreRebindsBearerPrincipals(t *testing.T) {
+	oauthConfig = &oauth2.Config{ClientID: "test-client-id"}
+	store, err := newFileTokenStore(filepath.Join(t.TempDir(), "tokens.enc"), bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newAccountRegistry(store)
+	token := &oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}
+	acct, err := r.newAccount(context.Background(), &userInfo{Sub: "alice"}, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.link(bearerPrincipalPrefix+"alice-work-laptop", acct)
+	r.link("session-a", acct)
+	r.save(acct, token)
+
+	restarted := newAccountRegistry(store)
+	if err := restarted.restore(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := restarted.forPrincipal(bearerPrincipalPrefix + "alice-work-laptop"); got == nil || got.ID != "alice" {
+		t.Fatalf("expected bearer binding to survive restart, got %+v", got)
+	}
+	if got := restarted.forPrincipal("session-a"); got != nil {
+		t.Fatalf("expected session binding to be dropped on restart, got %+v", got)
+	}
+}
+
+func TestFlushSavesLatestTokens(t *testing.T) {
+	oauthConfig = &oauth2.Config{ClientID: "test-client-id"}
+	store, err := newFileTokenStore(filepath.Join(t.TempDir(), "tokens.enc"), bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newAccountRegistry(store)
+	token := &oauth2.Token{AccessToken: "access", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)}
+	acct, err := r.newAccount(context.Background(), &userInfo{Sub: "alice"}, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Linked, but never saved
+	r.link(bearerPrincipalPrefix+"alice-work-laptop", acct)
+	r.flush()
+
+	records, err := store.LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Token.AccessToken != "access" || len(records[0].Principals) != 1 {
+		t.Fatalf("expected alice's token and binding to be flushed, got %+v", records)
+	}
+}
+
+func TestAccountRegistryLinksSeveralAccounts(t *testing.T) {
+	r := newAccountRegistry(nil)
+	r.link("session-a", &account{ID: "work", Email: "alice@work.example.com"})
+	r.link("session-a", &account{ID: "personal", Email: "alice@example.com"})
+	r.link("session-a", &account{ID: "work", Email: "alice@work.example.com"})
+
+	if got := r.accountsFor("session-a"); len(got) != 2 || got[0].ID != "work" || got[1].ID != "personal" {
+		t.Fatalf("expected work then personal, got %+v", got)
+	}
+	if got := r.forPrincipal("session-a"); got.ID != "work" {
+		t.Fatalf("expected the first linked account as default, got %s", got.ID)
+	}
+	if got, err := r.find("session-a", "Alice@Example.com"); err != nil || got.ID != "personal" {
+		t.Fatalf("expected personal by email, got %+v, %v", got, err)
+	}
+	if _, err := r.find("session-b", "alice@example.com"); err == nil {
+		t.Fatal("expected another principal not to find the account")
+	}
+
+	r.remove("work")
+	if got := r.accountsFor("session-a"); len(got) != 1 || got[0].ID != "personal" {
+		t.Fatalf("expected only personal after removing work, got %+v", got)
+	}
+}
+
+func TestSortEventsByStart(t *testing.T) {
+	events := []accountEvent{
+		{Event: &Event{Summary: "late", Start: EventTime{Time: time.Date(2025, 6, 2, 15, 0, 0, 0, time.FixedZone("CEST", 2*60*60))}}},
+		{Event: &Event{Summary: "all-day", Start: EventTime{Time: time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC), AllDay: true}}},
+		{Event: &Event{Summary: "early", Start: EventTime{Time: time.Date(2025, 6, 2, 8, 0, 0, 0, time.UTC)}}},
+	}
+	sortEventsByStart(events)
+	for i, want := range []string{"all-day", "early", "late"} {
+		if events[i].Event.Summary != want {
+			t.Fatalf("position %d: expected %s, got %s", i, want, events[i].Event.Summary)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/server"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oauthFlowRedirect = "redirect"
+	oauthFlowDevice   = "device"
+)
+
+// oauthFlow selects how users authorize. "redirect" sends the browser back
+// to /auth/callback; "device" shows a code to enter on any device, for
+// deployments without a reachable callback URL.
+var oauthFlow = oauthFlowRedirect
+
+var deviceAuths = newDeviceAuthRegistry()
+
+// newAuthTarget describes an authorization of scopes for the caller in ctx.
+// It fails when there is no MCP session to report back to.
+func newAuthTarget(ctx context.Context, forMethod string, scopes []string) (authTarget, error) {
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil {
+		return authTarget{}, fmt.Errorf("authentication requires an MCP session")
+	}
+	return authTarget{
+		Principal: principalFromContext(ctx),
+		SessionID: session.SessionID(),
+		ForMethod: forMethod,
+		Scopes:    scopes,
+	}, nil
+}
+
+// authorizationPrompt starts an authorization for target using the
+// configured flow and returns what the user has to do to complete it.
+func authorizationPrompt(s *server.MCPServer, target authTarget, loginHint string) (string, error) {
+	if oauthFlow == oauthFlowDevice {
+		da, err := startDeviceAuthorization(s, target)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Please visit %s and enter the code %s to authenticate.", da.VerificationURI, da.UserCode), nil
+	}
+
+	url, err := authorizationURL(target, loginHint)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Please visit this URL to authenticate: %s", url), nil
+}
+
+// authorizationURL starts an authorization for target and returns the Google
+// consent URL. Previously granted scopes are kept, so asking for more only
+// prompts for what is missing.
+func authorizationURL(target authTarget, loginHint string) (string, error) {
+	auth, err := pendingAuths.start(target)
+	if err != nil {
+		return "", err
+	}
+
+	config := *oauthConfig // shallow copy is fine since all fields are value or immutable
+	config.Scopes = target.Scopes
+	if oauthLoopback != nil {
+		if config.RedirectURL, err = oauthLoopback.redirectURL(auth.State); err != nil {
+			return "", err
+		}
+		auth.RedirectURL = config.RedirectURL
+	}
+	opts := []oauth2.AuthCodeOption{
+		oauth2.AccessTypeOffline,
+		oauth2.S256ChallengeOption(auth.Verifier),
+		oauth2.SetAuthURLParam("include_granted_scopes", "true"),
+	}
+	if loginHint != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("login_hint", loginHint))
+	} else if len(accounts.linked(target.Principal)) > 0 {
+		// Let the user pick another account rather than silently
+		// reauthorizing the one the browser is signed into
+		opts = append(opts, oauth2.SetAuthURLParam("prompt", "select_account"))
+	}
+	return config.AuthCodeURL(auth.State, opts...), nil
+}
+
+func handleAuthCallback(server *server.MCPServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		auth, err := pendingAuths.take(query.Get("state"))
+
+		// Google reports a declined consent screen, or other failures, with an
+		// error parameter instead of a code
+		if errorCode := query.Get("error"); errorCode != "" {
+			log.Println("authorization failed:", errorCode)
+			if auth != nil {
+				authWaits.complete(auth.SessionID, authResult{Err: fmt.Errorf("authorization failed: %s", errorCode)})
+			}
+			if errorCode == "access_denied" {
+				renderAuthPage(w, http.StatusForbidden, authDeclinedPage())
+				return
+			}
+			message := "Google did not grant access: " + errorCode
+			if description := query.Get("error_description"); description != "" {
+				message += " (" + description + ")"
+			}
+			renderAuthPage(w, http.StatusBadRequest, authFailurePage(message))
+			return
+		}
+
+		if err != nil {
+			log.Println("invalid state:", err)
+			message := "This sign-in link is not valid."
+			if errors.Is(err, errExpiredState) || errors.Is(err, errReusedState) {
+				message = "This sign-in link has expired or was already used."
+			}
+			renderAuthPage(w, http.StatusBadRequest, authFailurePage(message))
+			return
+		}
+
+		config := *oauthConfig
+		if auth.RedirectURL != "" {
+			config.RedirectURL = auth.RedirectURL
+		}
+		token, err := config.Exchange(context.Background(), query.Get("code"), oauth2.VerifierOption(auth.Verifier))
+		if err != nil {
+			log.Println("token exchange failed:", err)
+			authWaits.complete(auth.SessionID, authResult{Err: fmt.Errorf("token exchange failed")})
+			renderAuthPage(w, http.StatusInternalServerError, authFailurePage("Google did not accept the sign-in (token exchange failed)."))
+			return
+		}
+
+		acct, err := completeAuthorization(server, auth.authTarget, token)
+		if err != nil {
+			renderAuthPage(w, http.StatusInternalServerError, authFailurePage(fmt.Sprintf("Unable to link your Google account: %v.", err)))
+			return
+		}
+		renderAuthPage(w, http.StatusOK, authSuccessPage(acct))
+	}
+}
+
+// completeAuthorization links the Google account behind token to the target
+// principal and tells its session it may continue the method that asked.
+func completeAuthorization(server *server.MCPServer, target authTarget, token *oauth2.Token) (*account, error) {
+	info, err := fetchUserInfo(context.Background(), oauthConfig.Client(context.Background(), token))
+	if err != nil {
+		err = fmt.Errorf("unable to identify Google account: %w", err)
+		authWaits.complete(target.SessionID, authResult{Err: err})
+		return nil, err
+	}
+
+	// Google only issues a refresh token on first consent, so keep the one
+	// we already hold for a returning account
+	if token.RefreshToken == "" {
+		if prev := accounts.get(info.Sub); prev != nil {
+			if prevToken, err := prev.Token.Token(); err == nil {
+				token.RefreshToken = prevToken.RefreshToken
+			}
+		}
+	}
+
+	acct, err := accounts.newAccount(context.Background(), info, token)
+	if err != nil {
+		authWaits.complete(target.SessionID, authResult{Err: err})
+		return nil, err
+	}
+	acct.Scopes = grantedScopes(token, target.Scopes)
+
+	// Bind the account to the caller that asked for it, and only that one
+	accounts.link(target.Principal, acct)
+	accounts.save(acct, token)
+	authWaits.complete(target.SessionID, authResult{Account: acct})
+
+	// Notify the client to continue the method that requested authentication
+	// Note: Some MCP clients may not support this yet. e.g. Cursor
+	log.Println("sending notification to client")
+	server.SendNotificationToSpecificClient(
+		target.SessionID,
+		target.ForMethod,
+		map[string]any{},
+	)
+	log.Println("sent notification to client")
+
+	// Clients ignoring that get the result of the call that needed it instead
+	go resumeToolCall(server, target.SessionID)
+	return acct, nil
+}
+
+// logout disconnects the accounts principal acts as: the one named by
+// selector, or all of them when selector is empty. Their tokens are revoked
+// at Google and forgotten here, for every principal bound to them. The
+// returned text reports each account; revocation failures are noted there,
+// but the accounts are removed regardless.
+func logout(ctx context.Context, principal, selector string) (string, error) {
+	targets := accounts.accountsFor(principal)
+	if selector != "" {
+		acct, err := accounts.find(principal, selector)
+		if err != nil {
+			return "", err
+		}
+		targets = []*account{acct}
+	}
+	if len(targets) == 0 {
+		return "", fmt.Errorf("not authenticated")
+	}
+	if targets[0].configured() {
+		return "", fmt.Errorf("the server is authenticated with %s, which cannot be logged out", targets[0].method())
+	}
+
+	var result string
+	for _, acct := range targets {
+		token, err := acct.Token.Token()
+		accounts.remove(acct.ID)
+		if err == nil {
+			err = revokeToken(ctx, token)
+		} else {
+			err = fmt.Errorf("unable to get token to revoke: %w", err)
+		}
+		if err != nil {
+			result += fmt.Sprintf("Logged out %s, but %v\n", acct.Email, err)
+		} else {
+			result += fmt.Sprintf("Logged out %s and revoked its access.\n", acct.Email)
+		}
+	}
+	return result, nil
+}
+
+// revokeToken revokes token at Google. Revoking the refresh token also
+// revokes every access token issued from it.
+func revokeToken(ctx context.Context, token *oauth2.Token) error {
+	value := token.RefreshToken
+	if value == "" {
+		value = token.AccessToken
+	}
+	form := url.Values{"token": {value}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, googleRevokeURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("token revocation failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token revocation failed: %s", resp.Status)
+	}
+	return nil
+}
+
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Without bearer authorization the session ID identifies the caller, as
+	// it does on /mcp/message and /mcp
+	principal := principalFromContext(r.Context())
+	if principal == "" {
+		principal = r.URL.Query().Get("sessionId")
+	}
+	if principal == "" {
+		principal = r.Header.Get(streamableSessionHeader)
+	}
+	if principal == "" {
+		http.Error(w, "Missing sessionId", http.StatusBadRequest)
+		return
+	}
+
+	result, err := logout(r.Context(), principal, r.URL.Query().Get("account"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fmt.Fprint(w, result)
+}
+
+// startDeviceAuthorization asks Google for a user code and polls for the
+// grant in the background, linking the account to the target principal once
+// the user approves it on another device.
+func startDeviceAuthorization(s *server.MCPServer, target authTarget) (*oauth2.DeviceAuthResponse, error) {
+	config := *oauthConfig
+	config.Scopes = target.Scopes
+	da, err := config.DeviceAuth(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("device authorization request failed: %w", err)
+	}
+
+	ctx := deviceAuths.start(target.SessionID)
+	go func() {
+		defer deviceAuths.done(ctx, target.SessionID)
+		token, err := config.DeviceAccessToken(ctx, da)
+		if err != nil {
+			log.Printf("Device authorization for session %s did not complete: %v", target.SessionID, err)
+			// A cancelled poller was replaced or its session closed, so
+			// nobody waits for it
+			if ctx.Err() == nil {
+				authWaits.complete(target.SessionID, authResult{Err: err})
+			}
+			return
+		}
+		if _, err := completeAuthorization(s, target, token); err != nil {
+			log.Printf("Device authorization for session %s failed: %v", target.SessionID, err)
+		}
+	}()
+	return da, nil
+}
+
+// deviceAuthRegistry tracks the background poller of each session so a new
+// authorization, or the session going away, stops the previous one.
+type deviceAuthRegistry struct {
+	mu      sync.Mutex
+	pollers map[string]*devicePoller // by session ID
+}
+
+type devicePoller struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newDeviceAuthRegistry() *deviceAuthRegistry {
+	return &deviceAuthRegistry{pollers: make(map[string]*devicePoller)}
+}
+
+// start cancels any poller of sessionID and returns the context for a new one.
+func (r *deviceAuthRegistry) start(sessionID string) context.Context {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if prev, ok := r.pollers[sessionID]; ok {
+		prev.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.pollers[sessionID] = &devicePoller{ctx: ctx, cancel: cancel}
+	return ctx
+}
+
+// done releases the poller started with ctx, unless a newer one replaced it.
+func (r *deviceAuthRegistry) done(ctx context.Context, sessionID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if poller, ok := r.pollers[sessionID]; ok && poller.ctx == ctx {
+		poller.cancel()
+		delete(r.pollers, sessionID)
+	}
+}
+
+// cancel stops the poller of sessionID, if any.
+func (r *deviceAuthRegistry) cancel(sessionID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if poller, ok := r.pollers[sessionID]; ok {
+		poller.cancel()
+		delete(r.pollers, sessionID)
+	}
+}
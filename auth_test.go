@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"google-calendar-mcp/fakegoogle"
+)
+
+// useDeviceFlow switches the server to the OAuth device flow for t.
+func useDeviceFlow(t *testing.T) {
+	prev := oauthFlow
+	oauthFlow = oauthFlowDevice
+	t.Cleanup(func() { oauthFlow = prev })
+}
+
+// authenticateAsync calls the auth tool in the background and returns the
+// prompt it notifies, and a channel receiving its result.
+func (e *testEnv) authenticateAsync() (string, <-chan string) {
+	e.t.Helper()
+	done := make(chan string, 1)
+	go func() {
+		text, _ := e.call("auth", map[string]any{})
+		done <- text
+	}()
+	notification := e.waitNotification("notifications/message")
+	return fmt.Sprint(notification.Params.AdditionalFields["data"]), done
+}
+
+func awaitText(t *testing.T, done <-chan string) string {
+	t.Helper()
+	select {
+	case text := <-done:
+		return text
+	case <-time.After(10 * time.Second):
+		t.Fatal("auth tool did not return")
+		return ""
+	}
+}
+
+func TestE2EDeviceFlowPollsUntilApproved(t *testing.T) {
+	useDeviceFlow(t)
+	env := newTestEnv(t)
+	// The user takes a poll to enter the code
+	env.fake.SetDevicePendingPolls(1)
+
+	prompt, done := env.authenticateAsync()
+	if !strings.Contains(prompt, env.fake.URL+"/device") || !strings.Contains(prompt, "FAKE-CODE") {
+		t.Fatalf("expected the verification URL and user code, got %q", prompt)
+	}
+	if text := awaitText(t, done); !strings.Contains(text, "Authenticated as "+fakegoogle.DefaultUser.Email) {
+		t.Fatalf("unexpected auth result %q", text)
+	}
+	if text, isError := env.call("list_calendars", map[string]any{}); isError {
+		t.Fatalf("list_calendars after device authorization: %q", text)
+	}
+}
+
+func TestE2EDeviceFlowDenied(t *testing.T) {
+	useDeviceFlow(t)
+	env := newTestEnv(t)
+	env.fake.SetDenyConsent(true)
+
+	_, done := env.authenticateAsync()
+	if text := awaitText(t, done); !strings.Contains(text, "Authentication failed") || !strings.Contains(text, "access_denied") {
+		t.Fatalf("expected a declined device code to fail, got %q", text)
+	}
+	if text, _ := env.call("list_calendars", map[string]any{}); text != TOOL_ERROR_AUTHENTICATION_REQUIRED {
+		t.Fatalf("expected the session to stay unauthenticated, got %q", text)
+	}
+}
+
+func TestE2EDeviceFlowExpired(t *testing.T) {
+	useDeviceFlow(t)
+	env := newTestEnv(t)
+	env.fake.SetDevicePendingPolls(1000)
+
+	_, done := env.authenticateAsync()
+	env.fake.ExpireDeviceCodes()
+	if text := awaitText(t, done); !strings.Contains(text, "Authentication failed") || !strings.Contains(text, "expired_token") {
+		t.Fatalf("expected an expired device code to fail, got %q", text)
+	}
+}
+
+func TestDeviceAuthRegistryReplacesPollers(t *testing.T) {
+	r := newDeviceAuthRegistry()
+	first := r.start("session")
+	second := r.start("session")
+	if first.Err() == nil {
+		t.Fatal("expected a new authorization to stop the previous poller")
+	}
+
+	// The replaced poller finishing leaves the new one alone
+	r.done(first, "session")
+	if second.Err() != nil {
+		t.Fatal("expected the new poller to keep running")
+	}
+	r.cancel("session")
+	if second.Err() == nil {
+		t.Fatal("expected cancel to stop the poller")
+	}
+}
+
+// tokenActive reports whether the fake still accepts accessToken.
+func tokenActive(t *testing.T, fake *fakegoogle.Server, accessToken string) bool {
+	t.Helper()
+	resp, err := http.Get(fake.TokenInfoURL() + "?access_token=" + url.QueryEscape(accessToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func TestE2ELogoutEndpoint(t *testing.T) {
+	for _, transportName := range []string{transportSSE, transportStreamable} {
+		t.Run(transportName, func(t *testing.T) {
+			env := newTestEnvOver(t, transportName)
+			if text := env.authenticate(); !strings.Contains(text, "Authenticated as") {
+				t.Fatalf("unexpected auth result %q", text)
+			}
+			acct := accounts.linked(env.principal())[0]
+			token, err := acct.Token.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// SSE sessions name themselves in the query, Streamable HTTP ones
+			// in the header
+			req, _ := http.NewRequest(http.MethodPost, env.url+"/auth/logout", nil)
+			if transportName == transportSSE {
+				req.URL.RawQuery = url.Values{"sessionId": {env.principal()}}.Encode()
+			} else {
+				req.Header.Set(streamableSessionHeader, env.principal())
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "Logged out "+fakegoogle.DefaultUser.Email+" and revoked its access") {
+				t.Fatalf("logout: %s %s", resp.Status, body)
+			}
+
+			if accounts.get(acct.ID) != nil || len(accounts.linked(env.principal())) > 0 {
+				t.Error("expected the account to be unlinked")
+			}
+			if tokenActive(t, env.fake, token.AccessToken) {
+				t.Error("expected the token to be revoked at Google")
+			}
+			if text, _ := env.call("list_calendars", map[string]any{}); text != TOOL_ERROR_AUTHENTICATION_REQUIRED {
+				t.Errorf("expected the session to need authentication again, got %q", text)
+			}
+		})
+	}
+}
+
+func TestLogoutEndpointRequiresSession(t *testing.T) {
+	for method, want := range map[string]int{http.MethodPost: http.StatusBadRequest, http.MethodGet: http.StatusMethodNotAllowed} {
+		w := httptest.NewRecorder()
+		handleLogout(w, httptest.NewRequest(method, "/auth/logout", nil))
+		if w.Code != want {
+			t.Errorf("%s without a session: expected %d, got %d", method, want, w.Code)
+		}
+	}
+
+	// An unknown session has nothing to log out
+	w := httptest.NewRecorder()
+	handleLogout(w, httptest.NewRequest(http.MethodPost, "/auth/logout?sessionId=unknown", nil))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "not authenticated") {
+		t.Errorf("unknown session: %d %s", w.Code, w.Body)
+	}
+}
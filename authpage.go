@@ -0,0 +1,109 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+)
+
+// scopeDescriptions explains granted scopes to the user in their own words.
+var scopeDescriptions = map[string]string{
+	scopeEmail:            "See your email address",
+	scopeProfile:          "See your basic profile info",
+	scopeOpenID:           "Identify you by your Google account",
+	scopeCalendar:         "See, edit, share, and delete all your calendars",
+	scopeCalendarReadonly: "See your calendars and events",
+	scopeCalendarEvents:   "View and edit events on your calendars",
+}
+
+// authPage is what the user sees in the browser once Google redirects back
+// to /auth/callback.
+type authPage struct {
+	Success bool
+	Title   string
+	Message string
+	Account *account
+	Scopes  []string // described with scopeDescriptions
+	Next    string
+}
+
+var authPageTemplate = template.Must(template.New("auth").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}} - Google Calendar MCP</title>
+<style>
+  body { font-family: system-ui, sans-serif; max-width: 36rem; margin: 4rem auto; padding: 0 1rem; color: #202124; }
+  h1 { font-size: 1.5rem; }
+  .success h1 { color: #188038; }
+  .failure h1 { color: #d93025; }
+  .next { background: #f1f3f4; border-radius: 8px; padding: 1rem; }
+</style>
+</head>
+<body class="{{if .Success}}success{{else}}failure{{end}}">
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{- with .Account}}
+<p>Linked account: <strong>{{if .Name}}{{.Name}} &lt;{{.Email}}&gt;{{else}}{{.Email}}{{end}}</strong></p>
+{{- end}}
+{{- if .Scopes}}
+<p>Granted access:</p>
+<ul>
+{{- range .Scopes}}
+  <li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+<p class="next">{{.Next}}</p>
+</body>
+</html>
+`))
+
+// renderAuthPage writes page with the given status code.
+func renderAuthPage(w http.ResponseWriter, status int, page authPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := authPageTemplate.Execute(w, page); err != nil {
+		log.Printf("Unable to render auth page: %v", err)
+	}
+}
+
+// authSuccessPage describes acct, newly linked to an MCP client.
+func authSuccessPage(acct *account) authPage {
+	scopes := make([]string, 0, len(acct.Scopes))
+	for _, scope := range acct.Scopes {
+		if description, ok := scopeDescriptions[scope]; ok {
+			scopes = append(scopes, description)
+		} else {
+			scopes = append(scopes, scope)
+		}
+	}
+	return authPage{
+		Success: true,
+		Title:   "Authentication complete",
+		Message: "Google Calendar is now connected to your MCP client.",
+		Account: acct,
+		Scopes:  scopes,
+		Next:    "You can close this tab and return to your MCP client. A request to read your calendar that asked you to sign in continues on its own. A change, such as creating or deleting an event, is not made for you: ask for it again now that you are signed in.",
+	}
+}
+
+// authFailurePage explains why authentication failed and how to retry.
+func authFailurePage(message string) authPage {
+	return authPage{
+		Title:   "Authentication failed",
+		Message: message,
+		Next:    "Return to your MCP client and call the auth tool again to get a new link.",
+	}
+}
+
+// authDeclinedPage is shown when the user denied consent on Google's screen.
+func authDeclinedPage() authPage {
+	return authPage{
+		Title:   "Access not granted",
+		Message: "You declined to give access to your Google Calendar, so nothing was shared.",
+		Next:    "The calendar tools need this access. If you change your mind, return to your MCP client and call the auth tool again.",
+	}
+}
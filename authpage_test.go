@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestAuthCallbackAccessDenied(t *testing.T) {
+	auth, err := pendingAuths.start(authTarget{Principal: "session-denied", SessionID: "session-denied", Scopes: readScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, stop := authWaits.wait("session-denied")
+	defer stop()
+
+	rec := httptest.NewRecorder()
+	query := url.Values{"error": {"access_denied"}, "state": {auth.State}}
+	handleAuthCallback(server.NewMCPServer("test", "0.0.0"))(rec, httptest.NewRequest(http.MethodGet, "/auth/callback?"+query.Encode(), nil))
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Fatalf("expected an HTML page, got %s", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "declined") {
+		t.Fatalf("expected the page to explain consent was declined, got:\n%s", rec.Body)
+	}
+	select {
+	case result := <-results:
+		if result.Err == nil {
+			t.Fatal("expected the waiting auth tool to fail")
+		}
+	default:
+		t.Fatal("expected the waiting auth tool to be woken")
+	}
+}
+
+func TestAuthCallbackUnknownState(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleAuthCallback(server.NewMCPServer("test", "0.0.0"))(rec, httptest.NewRequest(http.MethodGet, "/auth/callback?state=forged&code=x", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "Authentication failed") || !strings.Contains(body, "auth tool again") {
+		t.Fatalf("expected a failure page with next steps, got:\n%s", body)
+	}
+}
+
+func TestAuthSuccessPageEscapesAccount(t *testing.T) {
+	rec := httptest.NewRecorder()
+	renderAuthPage(rec, http.StatusOK, authSuccessPage(&account{
+		Email:  "alice@example.com",
+		Name:   "<script>alert(1)</script>",
+		Scopes: []string{scopeCalendarReadonly, "https://example.com/custom"},
+	}))
+
+	body := rec.Body.String()
+	if strings.Contains(body, "<script>") {
+		t.Fatalf("expected the account name to be escaped, got:\n%s", body)
+	}
+	for _, want := range []string{"alice@example.com", "See your calendars and events", "https://example.com/custom", "ask for it again"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected page to contain %q", want)
+		}
+	}
+}
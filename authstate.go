@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// pendingAuthTTL bounds how long a user may take to finish consent.
+const pendingAuthTTL = 10 * time.Minute
+
+var (
+	errUnknownState = errors.New("unknown OAuth state")
+	errReusedState  = errors.New("OAuth state was already used")
+	errExpiredState = errors.New("OAuth state has expired")
+)
+
+// authTarget says what an authorization is for: the principal the Google
+// account gets bound to, the session to notify once it completes, and the
+// method and scopes that prompted it.
+type authTarget struct {
+	Principal string
+	SessionID string
+	ForMethod string
+	Scopes    []string
+}
+
+// pendingAuth is an authorization started by the `auth` tool that the
+// callback has not completed yet. The OAuth state parameter is only an
+// opaque key to it, so nothing the browser sends back is trusted.
+type pendingAuth struct {
+	authTarget
+	State string
+	// Verifier is the PKCE code verifier; only its S256 challenge leaves the
+	// server, so an intercepted code cannot be exchanged by anyone else.
+	Verifier string
+	// RedirectURL is where Google sends the browser back to, which the
+	// token exchange has to name again. Empty for oauthConfig's.
+	RedirectURL string
+	Expires     time.Time
+	used        bool
+}
+
+type pendingAuthStore struct {
+	mu      sync.Mutex
+	pending map[string]*pendingAuth // by state
+	now     func() time.Time
+}
+
+func newPendingAuthStore() *pendingAuthStore {
+	return &pendingAuthStore{
+		pending: make(map[string]*pendingAuth),
+		now:     time.Now,
+	}
+}
+
+// start records a new authorization for target, identified by a random state
+// and carrying a fresh PKCE verifier.
+func (s *pendingAuthStore) start(target authTarget) (*pendingAuth, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	state := base64.RawURLEncoding.EncodeToString(buf)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for key, auth := range s.pending {
+		if now.After(auth.Expires) {
+			delete(s.pending, key)
+		}
+	}
+	auth := &pendingAuth{
+		authTarget: target,
+		State:      state,
+		Verifier:   oauth2.GenerateVerifier(),
+		Expires:    now.Add(pendingAuthTTL),
+	}
+	s.pending[state] = auth
+	return auth, nil
+}
+
+// take consumes state. Used states are remembered until they expire so a
+// replayed callback is reported as such rather than as unknown.
+func (s *pendingAuthStore) take(state string) (*pendingAuth, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	auth, ok := s.pending[state]
+	switch {
+	case !ok:
+		return nil, errUnknownState
+	case auth.used:
+		return nil, errReusedState
+	case s.now().After(auth.Expires):
+		delete(s.pending, state)
+		return nil, errExpiredState
+	}
+	auth.used = true
+	return auth, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPendingAuthStateIsSingleUse(t *testing.T) {
+	store := newPendingAuthStore()
+	started, err := store.start(authTarget{Principal: "session-a", SessionID: "session-a", ForMethod: "list_events", Scopes: readScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := store.take(started.State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.SessionID != "session-a" || auth.ForMethod != "list_events" {
+		t.Fatalf("unexpected pending auth: %+v", auth)
+	}
+
+	if _, err := store.take(started.State); !errors.Is(err, errReusedState) {
+		t.Fatalf("expected reused state error, got %v", err)
+	}
+	if _, err := store.take("forged"); !errors.Is(err, errUnknownState) {
+		t.Fatalf("expected unknown state error, got %v", err)
+	}
+}
+
+func TestPendingAuthStateExpires(t *testing.T) {
+	now := time.Now()
+	store := newPendingAuthStore()
+	store.now = func() time.Time { return now }
+
+	auth, err := store.start(authTarget{Principal: "session-a", SessionID: "session-a", Scopes: readScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(pendingAuthTTL + time.Second)
+	if _, err := store.take(auth.State); !errors.Is(err, errExpiredState) {
+		t.Fatalf("expected expired state error, got %v", err)
+	}
+}
+
+func TestPendingAuthsAreUnique(t *testing.T) {
+	store := newPendingAuthStore()
+	a, _ := store.start(authTarget{Principal: "session-a", SessionID: "session-a", Scopes: readScopes})
+	b, _ := store.start(authTarget{Principal: "session-a", SessionID: "session-a", Scopes: readScopes})
+	if a.State == b.State {
+		t.Fatal("expected distinct states")
+	}
+	if a.Verifier == "" || a.Verifier == b.Verifier {
+		t.Fatal("expected distinct PKCE verifiers")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// authWaitTimeout bounds how long the `auth` tool blocks for the user to
+// finish consent. Zero returns the prompt right away without waiting.
+var authWaitTimeout = 5 * time.Minute
+
+// authProgressInterval is how often a waiting `auth` tool reports progress,
+// which also keeps clients from timing out the call.
+const authProgressInterval = 10 * time.Second
+
+var authWaits = newAuthWaitRegistry()
+
+// authResult is the outcome of an authorization a session waits for.
+type authResult struct {
+	Account *account
+	Err     error
+}
+
+// authWaitRegistry wakes the `auth` tool calls of a session once an
+// authorization it started completes, wherever that happens: the redirect
+// callback or the device-flow poller.
+type authWaitRegistry struct {
+	mu      sync.Mutex
+	waiters map[string][]chan authResult // by session ID
+}
+
+func newAuthWaitRegistry() *authWaitRegistry {
+	return &authWaitRegistry{waiters: make(map[string][]chan authResult)}
+}
+
+// wait subscribes to the next authorization result of sessionID. Call stop
+// once no longer interested.
+func (r *authWaitRegistry) wait(sessionID string) (results <-chan authResult, stop func()) {
+	ch := make(chan authResult, 1)
+	r.mu.Lock()
+	r.waiters[sessionID] = append(r.waiters[sessionID], ch)
+	r.mu.Unlock()
+
+	return ch, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		waiters := r.waiters[sessionID]
+		for i, waiter := range waiters {
+			if waiter == ch {
+				waiters = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+		if len(waiters) == 0 {
+			delete(r.waiters, sessionID)
+		} else {
+			r.waiters[sessionID] = waiters
+		}
+	}
+}
+
+// complete hands result to everyone waiting on sessionID.
+func (r *authWaitRegistry) complete(sessionID string, result authResult) {
+	r.mu.Lock()
+	waiters := r.waiters[sessionID]
+	delete(r.waiters, sessionID)
+	r.mu.Unlock()
+
+	for _, ch := range waiters {
+		ch <- result
+	}
+}
+
+// completeAll hands result to everyone waiting on any session.
+func (r *authWaitRegistry) completeAll(result authResult) {
+	r.mu.Lock()
+	waiters := r.waiters
+	r.waiters = make(map[string][]chan authResult)
+	r.mu.Unlock()
+
+	for _, chs := range waiters {
+		for _, ch := range chs {
+			ch <- result
+		}
+	}
+}
+
+// awaitAuthorization starts an authorization for target, sends the prompt to
+// the client as log and progress notifications, and blocks until the user
+// completes it, ctx is cancelled, or authWaitTimeout passes. It returns the
+// text of the tool result.
+func awaitAuthorization(ctx context.Context, s *server.MCPServer, request mcp.CallToolRequest, target authTarget) (string, error) {
+	results, stop := authWaits.wait(target.SessionID)
+	defer stop()
+
+	prompt, err := authorizationPrompt(s, target, "")
+	if err != nil {
+		return "", err
+	}
+	if authWaitTimeout <= 0 {
+		return prompt, nil
+	}
+
+	var progressToken mcp.ProgressToken
+	if request.Params.Meta != nil {
+		progressToken = request.Params.Meta.ProgressToken
+	}
+	progress := 0
+	notify := func(message string) {
+		s.SendNotificationToClient(ctx, "notifications/message", map[string]any{
+			"level":  mcp.LoggingLevelInfo,
+			"logger": "auth",
+			"data":   message,
+		})
+		if progressToken != nil {
+			s.SendNotificationToClient(ctx, "notifications/progress", map[string]any{
+				"progressToken": progressToken,
+				"progress":      progress,
+				"message":       message,
+			})
+		}
+		progress++
+	}
+	notify(prompt)
+
+	timeout := time.NewTimer(authWaitTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(authProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case result := <-results:
+			if result.Err != nil {
+				return fmt.Sprintf("Authentication failed: %v. Please try again.", result.Err), nil
+			}
+			return fmt.Sprintf("Authenticated as %s. You can now use the Google Calendar tools.", result.Account.Email), nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-timeout.C:
+			return fmt.Sprintf("Authentication did not complete within %s. %s. Once done, retry the tool that needed it.", authWaitTimeout, prompt), nil
+		case <-ticker.C:
+			notify("Waiting for authentication to complete. " + prompt)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"golang.org/x/oauth2"
+)
+
+func TestAuthWaitRegistryWakesSessionWaiters(t *testing.T) {
+	r := newAuthWaitRegistry()
+	results, stop := r.wait("session-a")
+	defer stop()
+	other, stopOther := r.wait("session-b")
+	defer stopOther()
+
+	r.complete("session-a", authResult{Account: &account{Email: "alice@example.com"}})
+	select {
+	case result := <-results:
+		if result.Account.Email != "alice@example.com" {
+			t.Fatalf("unexpected result: %+v", result)
+		}
+	default:
+		t.Fatal("expected session-a to be woken")
+	}
+	select {
+	case result := <-other:
+		t.Fatalf("expected session-b to keep waiting, got %+v", result)
+	default:
+	}
+}
+
+func TestAwaitAuthorizationReturnsOnCompletion(t *testing.T) {
+	oauthConfig = &oauth2.Config{ClientID: "test-client-id", Endpoint: oauth2.Endpoint{AuthURL: "https://accounts.example.com/auth"}}
+	target := authTarget{Principal: "session-wait", SessionID: "session-wait", Scopes: readScopes}
+
+	go func() {
+		// Complete as soon as the tool subscribed
+		for {
+			authWaits.mu.Lock()
+			waiting := len(authWaits.waiters[target.SessionID]) > 0
+			authWaits.mu.Unlock()
+			if waiting {
+				authWaits.complete(target.SessionID, authResult{Account: &account{Email: "alice@example.com"}})
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	s := server.NewMCPServer("test", "0.0.0")
+	result, err := awaitAuthorization(context.Background(), s, mcp.CallToolRequest{}, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result, "Authenticated as alice@example.com") {
+		t.Fatalf("unexpected result: %s", result)
+	}
+}
+
+func TestAwaitAuthorizationTimesOut(t *testing.T) {
+	oauthConfig = &oauth2.Config{ClientID: "test-client-id", Endpoint: oauth2.Endpoint{AuthURL: "https://accounts.example.com/auth"}}
+	defer func(timeout time.Duration) { authWaitTimeout = timeout }(authWaitTimeout)
+	authWaitTimeout = 10 * time.Millisecond
+
+	s := server.NewMCPServer("test", "0.0.0")
+	result, err := awaitAuthorization(context.Background(), s, mcp.CallToolRequest{},
+		authTarget{Principal: "session-slow", SessionID: "session-slow", Scopes: readScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result, "did not complete") || !strings.Contains(result, "https://accounts.example.com/auth") {
+		t.Fatalf("expected a timeout with the consent URL, got: %s", result)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// CalendarBackend is everything the tools need from a calendar provider.
+// Implementations must be safe for concurrent use.
+type CalendarBackend interface {
+	// ListCalendars returns the calendars the account can access.
+	ListCalendars(ctx context.Context) ([]*Calendar, error)
+	// ListEvents returns the events of a calendar matching query, expanded
+	// to single instances and ordered by start time.
+	ListEvents(ctx context.Context, calendarID string, query EventQuery) ([]*Event, error)
+	// GetEvent returns one event of a calendar.
+	GetEvent(ctx context.Context, calendarID, eventID string) (*Event, error)
+	// CreateEvent adds event to a calendar and returns it as stored, with
+	// its ID set.
+	CreateEvent(ctx context.Context, calendarID string, event *Event) (*Event, error)
+	// DeleteEvent removes an event from a calendar.
+	DeleteEvent(ctx context.Context, calendarID, eventID string) error
+	// FreeBusy returns the busy periods of each calendar between timeMin and
+	// timeMax, by calendar ID.
+	FreeBusy(ctx context.Context, calendarIDs []string, timeMin, timeMax time.Time) (map[string][]TimeRange, error)
+	// Settings returns the account's calendar preferences.
+	Settings(ctx context.Context) (*CalendarSettings, error)
+}
+
+// Calendar is a calendar an account can access. The primary calendar can
+// also be addressed as "primary".
+type Calendar struct {
+	ID       string
+	Summary  string
+	Primary  bool
+	TimeZone string
+}
+
+// Event is a single calendar event.
+type Event struct {
+	ID          string
+	Summary     string
+	Description string
+	Location    string
+	Start       EventTime
+	End         EventTime
+	Status      string
+	HTMLLink    string
+}
+
+// EventTime is when an event starts or ends. For all-day events only the
+// date of Time is meaningful.
+type EventTime struct {
+	Time   time.Time
+	AllDay bool
+}
+
+// String formats t as the Calendar API does: a date for all-day events,
+// RFC 3339 otherwise.
+func (t EventTime) String() string {
+	if t.AllDay {
+		return t.Time.Format(time.DateOnly)
+	}
+	return t.Time.Format(time.RFC3339)
+}
+
+// EventQuery narrows ListEvents. Zero fields do not restrict anything.
+type EventQuery struct {
+	TimeMin    time.Time
+	TimeMax    time.Time
+	MaxResults int64
+}
+
+// TimeRange is a busy period.
+type TimeRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// CalendarSettings are an account's calendar preferences.
+type CalendarSettings struct {
+	TimeZone  string
+	Locale    string
+	WeekStart time.Weekday
+}
+
+// freeBusyFromEvents derives busy periods from the events of each calendar,
+// for backends without a free/busy query of their own.
+func freeBusyFromEvents(ctx context.Context, backend CalendarBackend, calendarIDs []string, timeMin, timeMax time.Time) (map[string][]TimeRange, error) {
+	busy := make(map[string][]TimeRange, len(calendarIDs))
+	for _, id := range calendarIDs {
+		events, err := backend.ListEvents(ctx, id, EventQuery{TimeMin: timeMin, TimeMax: timeMax})
+		if err != nil {
+			return nil, err
+		}
+		ranges := make([]TimeRange, 0, len(events))
+		for _, event := range events {
+			ranges = append(ranges, TimeRange{Start: event.Start.Time, End: event.End.Time})
+		}
+		busy[id] = ranges
+	}
+	return busy, nil
+}
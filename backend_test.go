@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+
+	"google-calendar-mcp/fakegoogle"
+)
+
+// testBackend checks the behavior of a CalendarBackend the tools rely on.
+func testBackend(t *testing.T, backend CalendarBackend) {
+	ctx := context.Background()
+	day := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+
+	calendars, err := backend.ListCalendars(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calendars) == 0 || !calendars[0].Primary {
+		t.Fatalf("expected the primary calendar, got %+v", calendars)
+	}
+
+	review, err := backend.CreateEvent(ctx, "primary", &Event{
+		Summary:  "Review",
+		Location: "Room 1",
+		Start:    EventTime{Time: day.Add(10 * time.Hour)},
+		End:      EventTime{Time: day.Add(11 * time.Hour)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if review.ID == "" || review.Summary != "Review" {
+		t.Fatalf("unexpected created event %+v", review)
+	}
+	if _, err := backend.CreateEvent(ctx, "primary", &Event{
+		Summary: "Standup",
+		Start:   EventTime{Time: day.Add(8 * time.Hour)},
+		End:     EventTime{Time: day.Add(9 * time.Hour)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := backend.ListEvents(ctx, "primary", EventQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Summary != "Standup" || events[1].Summary != "Review" {
+		t.Fatalf("expected events ordered by start, got %+v", events)
+	}
+	events, err = backend.ListEvents(ctx, "primary", EventQuery{TimeMin: day.Add(9*time.Hour + 30*time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Summary != "Review" {
+		t.Fatalf("expected only events after time_min, got %+v", events)
+	}
+	events, err = backend.ListEvents(ctx, "primary", EventQuery{MaxResults: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Summary != "Standup" {
+		t.Fatalf("expected max_results to keep the earliest, got %+v", events)
+	}
+
+	got, err := backend.GetEvent(ctx, "primary", review.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Location != "Room 1" || !got.Start.Time.Equal(day.Add(10*time.Hour)) || got.Start.AllDay {
+		t.Fatalf("unexpected event %+v", got)
+	}
+
+	busy, err := backend.FreeBusy(ctx, []string{"primary"}, day, day.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if periods := busy["primary"]; len(periods) != 2 || !periods[1].End.Equal(day.Add(11*time.Hour)) {
+		t.Fatalf("unexpected busy periods %+v", busy)
+	}
+
+	settings, err := backend.Settings(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.TimeZone != "UTC" || settings.WeekStart != time.Monday {
+		t.Fatalf("unexpected settings %+v", settings)
+	}
+
+	if err := backend.DeleteEvent(ctx, "primary", review.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.GetEvent(ctx, "primary", review.ID); err == nil {
+		t.Fatal("expected the deleted event to be gone")
+	}
+	if _, err := backend.ListEvents(ctx, "missing", EventQuery{}); err == nil {
+		t.Fatal("expected an unknown calendar to fail")
+	}
+}
+
+func TestMemoryBackend(t *testing.T) {
+	testBackend(t, newMemoryBackend("user@example.com"))
+}
+
+func TestGoogleBackend(t *testing.T) {
+	fake := fakegoogle.New()
+	defer fake.Close()
+
+	var code string
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code = r.URL.Query().Get("code")
+	}))
+	defer callback.Close()
+	config := &oauth2.Config{
+		ClientID:    "fake-client-id",
+		RedirectURL: callback.URL,
+		Scopes:      []string{scopeCalendarReadonly, scopeCalendarEvents},
+		Endpoint:    fake.Endpoint(),
+	}
+	resp, err := http.Get(config.AuthCodeURL("state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	token, err := config.Exchange(context.Background(), code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := calendar.NewService(context.Background(),
+		option.WithTokenSource(config.TokenSource(context.Background(), token)),
+		option.WithEndpoint(fake.CalendarURL()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBackend(t, newGoogleBackend(srv))
+}
@@ -0,0 +1,698 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// caldavAccountScopes stand in for what a CalDAV password allows: everything
+// the tools do.
+var caldavAccountScopes = []string{scopeCalendar}
+
+// newCalDAVAccount builds an account for a CalDAV server, such as Nextcloud
+// or Fastmail, signed in with username and password. Discovery runs right
+// away so bad credentials or URLs fail at startup.
+func newCalDAVAccount(ctx context.Context, endpoint, username, password string) (*account, error) {
+	backend, err := newCalDAVBackend(endpoint, username, password)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := backend.ListCalendars(ctx); err != nil {
+		return nil, fmt.Errorf("unable to discover CalDAV calendars: %w", err)
+	}
+	return &account{
+		ID:      "caldav:" + username + "@" + backend.endpoint.Host,
+		Email:   username,
+		Name:    backend.endpoint.Host,
+		Scopes:  caldavAccountScopes,
+		Backend: backend,
+
+		CalDAV: true,
+	}, nil
+}
+
+// caldavBackend is the CalendarBackend of a CalDAV server (RFC 4791).
+// Calendars are the collections of the user's calendar home, identified by
+// their last path segment; the first one is primary. Events are calendar
+// object resources, identified by their name without ".ics", and instances of
+// recurring ones by that name and their RECURRENCE-ID. Objects are requested
+// at the href the server lists them under, which need not be that name plus
+// ".ics" in the calendar collection.
+type caldavBackend struct {
+	client   *http.Client
+	endpoint *url.URL // where discovery starts
+	username string
+	password string
+
+	mu        sync.Mutex
+	calendars []*caldavCalendar // discovered on first use
+}
+
+type caldavCalendar struct {
+	Calendar
+	url *url.URL
+
+	mu    sync.Mutex
+	hrefs map[string]*url.URL // of the objects listed so far, by event ID
+}
+
+// href returns where the server listed the object of an event, or nil.
+func (cal *caldavCalendar) href(id string) *url.URL {
+	cal.mu.Lock()
+	defer cal.mu.Unlock()
+	return cal.hrefs[id]
+}
+
+// setHref records where the object of an event lives, or forgets it when u
+// is nil.
+func (cal *caldavCalendar) setHref(id string, u *url.URL) {
+	cal.mu.Lock()
+	defer cal.mu.Unlock()
+	if u == nil {
+		delete(cal.hrefs, id)
+		return
+	}
+	if cal.hrefs == nil {
+		cal.hrefs = make(map[string]*url.URL)
+	}
+	cal.hrefs[id] = u
+}
+
+func newCalDAVBackend(endpoint, username, password string) (*caldavBackend, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid CalDAV URL %q", endpoint)
+	}
+	return &caldavBackend{
+		// PROPFIND and REPORT must not turn into GETs on redirects, so the
+		// backend follows them itself
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		endpoint: u,
+		username: username,
+		password: password,
+	}, nil
+}
+
+func (b *caldavBackend) ListCalendars(ctx context.Context) ([]*Calendar, error) {
+	cals, err := b.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	calendars := make([]*Calendar, 0, len(cals))
+	for _, cal := range cals {
+		calendar := cal.Calendar
+		calendars = append(calendars, &calendar)
+	}
+	return calendars, nil
+}
+
+func (b *caldavBackend) ListEvents(ctx context.Context, calendarID string, query EventQuery) ([]*Event, error) {
+	cal, err := b.calendar(ctx, calendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ask the server to expand recurrences when the range is bounded
+	var timeRange, expand string
+	if !query.TimeMin.IsZero() || !query.TimeMax.IsZero() {
+		timeRange = fmt.Sprintf(`<c:time-range%s%s/>`, caldavTimeAttr("start", query.TimeMin), caldavTimeAttr("end", query.TimeMax))
+	}
+	if !query.TimeMin.IsZero() && !query.TimeMax.IsZero() {
+		expand = fmt.Sprintf(`<c:expand%s%s/>`, caldavTimeAttr("start", query.TimeMin), caldavTimeAttr("end", query.TimeMax))
+	}
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/><c:calendar-data>` + expand + `</c:calendar-data></d:prop>
+  <c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT">` + timeRange + `</c:comp-filter></c:comp-filter></c:filter>
+</c:calendar-query>`
+	responses, err := b.multistatus(ctx, "REPORT", cal.url, "1", body)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*Event
+	for _, resp := range responses {
+		if resp.Prop.CalendarData == "" {
+			continue
+		}
+		href, err := cal.url.Parse(resp.Href)
+		if err != nil {
+			return nil, err
+		}
+		id := caldavEventID(href)
+		cal.setHref(id, href)
+		vcalendar, err := parseICalendar(strings.NewReader(resp.Prop.CalendarData))
+		if err != nil {
+			return nil, fmt.Errorf("event %s: %w", id, err)
+		}
+		// Servers differ in how exactly they filter and whether they expand,
+		// so do both here too
+		instances, err := expandICalendarEvents(vcalendar.events(), query.TimeMin, query.TimeMax)
+		if err != nil {
+			return nil, fmt.Errorf("event %s: %w", id, err)
+		}
+		for _, instance := range instances {
+			instance.Event.ID = id
+			if !instance.RecurrenceID.Time.IsZero() {
+				instance.Event.ID = instanceID(id, instance.RecurrenceID)
+			}
+			events = append(events, instance.Event)
+		}
+	}
+	slices.SortStableFunc(events, func(a, b *Event) int { return a.Start.Time.Compare(b.Start.Time) })
+	if query.MaxResults > 0 && int64(len(events)) > query.MaxResults {
+		events = events[:query.MaxResults]
+	}
+	return events, nil
+}
+
+func (b *caldavBackend) GetEvent(ctx context.Context, calendarID, eventID string) (*Event, error) {
+	obj, err := b.getObject(ctx, calendarID, eventID)
+	if err != nil {
+		return nil, err
+	}
+	vcalendar, err := parseICalendar(bytes.NewReader(obj.data))
+	if err != nil {
+		return nil, fmt.Errorf("event %s: %w", eventID, err)
+	}
+
+	// A recurring event's overrides come after the master, which has no
+	// RECURRENCE-ID
+	vevents := vcalendar.events()
+	if len(vevents) == 0 {
+		return nil, fmt.Errorf("event %s not found", eventID)
+	}
+	var event *Event
+	if obj.recurrenceID.IsZero() {
+		vevent := vevents[0]
+		for _, candidate := range vevents {
+			if candidate.prop("RECURRENCE-ID") == nil {
+				vevent = candidate
+				break
+			}
+		}
+		event, err = eventFromICalendar(vevent)
+	} else {
+		event, err = icalInstanceAt(vevents, obj.recurrenceID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("event %s: %w", eventID, err)
+	}
+	event.ID = eventID
+	return event, nil
+}
+
+func (b *caldavBackend) CreateEvent(ctx context.Context, calendarID string, event *Event) (*Event, error) {
+	cal, err := b.calendar(ctx, calendarID)
+	if err != nil {
+		return nil, err
+	}
+	uid := make([]byte, 16)
+	rand.Read(uid)
+	id := hex.EncodeToString(uid)
+
+	var body bytes.Buffer
+	if err := newICalendarEvent(id, event).encode(&body); err != nil {
+		return nil, err
+	}
+	href := cal.url.JoinPath(id + ".ics")
+	req, err := b.newRequest(ctx, http.MethodPut, href, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/calendar; charset=utf-8")
+	// Never overwrite another event that happens to have the name
+	req.Header.Set("If-None-Match", "*")
+	resp, err := b.do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	cal.setHref(id, href)
+
+	created := *event
+	created.ID = id
+	created.Status = "confirmed"
+	return &created, nil
+}
+
+// DeleteEvent deletes a whole event, or one instance of a recurring event by
+// excluding it from the recurrence.
+func (b *caldavBackend) DeleteEvent(ctx context.Context, calendarID, eventID string) error {
+	obj, err := b.getObject(ctx, calendarID, eventID)
+	if err != nil {
+		return err
+	}
+	cal, err := b.calendar(ctx, calendarID)
+	if err != nil {
+		return err
+	}
+
+	var req *http.Request
+	if obj.recurrenceID.IsZero() {
+		req, err = b.newRequest(ctx, http.MethodDelete, obj.url, nil)
+	} else {
+		var body bytes.Buffer
+		if err := excludeCalDAVInstance(obj, &body); err != nil {
+			return fmt.Errorf("event %s: %w", eventID, err)
+		}
+		if req, err = b.newRequest(ctx, http.MethodPut, obj.url, &body); err == nil {
+			req.Header.Set("Content-Type", "text/calendar; charset=utf-8")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	// Only change the version that was looked at
+	if obj.etag != "" {
+		req.Header.Set("If-Match", obj.etag)
+	}
+	resp, err := b.do(req)
+	if err != nil {
+		if errors.Is(err, errCalDAVPrecondition) {
+			return fmt.Errorf("event %s changed while deleting it, plz retry", eventID)
+		}
+		return err
+	}
+	resp.Body.Close()
+	if obj.recurrenceID.IsZero() {
+		cal.setHref(obj.id, nil)
+	}
+	return nil
+}
+
+func (b *caldavBackend) FreeBusy(ctx context.Context, calendarIDs []string, timeMin, timeMax time.Time) (map[string][]TimeRange, error) {
+	return freeBusyFromEvents(ctx, b, calendarIDs, timeMin, timeMax)
+}
+
+// Settings reports the primary calendar's time zone. CalDAV has no notion of
+// a locale, and weeks start on Monday as in iCalendar.
+func (b *caldavBackend) Settings(ctx context.Context) (*CalendarSettings, error) {
+	cal, err := b.calendar(ctx, "primary")
+	if err != nil {
+		return nil, err
+	}
+	settings := &CalendarSettings{TimeZone: cal.TimeZone, WeekStart: time.Monday}
+	if settings.TimeZone == "" {
+		settings.TimeZone = "UTC"
+	}
+	return settings, nil
+}
+
+// calendar returns the calendar with id, which may be "primary".
+func (b *caldavBackend) calendar(ctx context.Context, id string) (*caldavCalendar, error) {
+	cals, err := b.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, cal := range cals {
+		if cal.ID == id || (id == "primary" && cal.Primary) {
+			return cal, nil
+		}
+	}
+	return nil, fmt.Errorf("calendar %s not found", id)
+}
+
+// discover finds the user's calendars once (RFC 6764 and RFC 4791 section
+// 6): the principal of the endpoint, its calendar home, and the collections
+// in it that hold events.
+func (b *caldavBackend) discover(ctx context.Context) ([]*caldavCalendar, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.calendars != nil {
+		return b.calendars, nil
+	}
+
+	// A bare host is discovered through its well-known URL
+	start := b.endpoint
+	if start.Path == "" || start.Path == "/" {
+		start = start.ResolveReference(&url.URL{Path: "/.well-known/caldav"})
+	}
+	home, err := b.calendarHome(ctx, start)
+	if err != nil {
+		return nil, err
+	}
+
+	responses, err := b.multistatus(ctx, "PROPFIND", home, "1", `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:resourcetype/><d:displayname/><c:supported-calendar-component-set/><c:calendar-timezone/></d:prop>
+</d:propfind>`)
+	if err != nil {
+		return nil, err
+	}
+	var calendars []*caldavCalendar
+	for _, resp := range responses {
+		if resp.Prop.ResourceType.Calendar == nil || !resp.Prop.ComponentSet.has("VEVENT") {
+			continue
+		}
+		u, err := home.Parse(resp.Href)
+		if err != nil {
+			return nil, err
+		}
+		id := path.Base(strings.TrimSuffix(u.Path, "/"))
+		summary := resp.Prop.DisplayName
+		if summary == "" {
+			summary = id
+		}
+		calendars = append(calendars, &caldavCalendar{
+			Calendar: Calendar{ID: id, Summary: summary, TimeZone: caldavTimezoneID(resp.Prop.CalendarTimezone)},
+			url:      u,
+		})
+	}
+	if len(calendars) == 0 {
+		return nil, fmt.Errorf("no event calendars in %s", home)
+	}
+	calendars[0].Primary = true
+	b.calendars = calendars
+	return calendars, nil
+}
+
+// calendarHome finds the calendar-home-set of the current user from start,
+// going through the user's principal when start does not report it.
+func (b *caldavBackend) calendarHome(ctx context.Context, start *url.URL) (*url.URL, error) {
+	const body = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:current-user-principal/><c:calendar-home-set/></d:prop>
+</d:propfind>`
+	target := start
+	for range 2 {
+		responses, err := b.multistatus(ctx, "PROPFIND", target, "0", body)
+		if err != nil {
+			return nil, err
+		}
+		if len(responses) == 0 {
+			break
+		}
+		prop := responses[0].Prop
+		if prop.CalendarHomeSet.Href != "" {
+			return target.Parse(prop.CalendarHomeSet.Href)
+		}
+		if prop.CurrentUserPrincipal.Href == "" {
+			break
+		}
+		if target, err = target.Parse(prop.CurrentUserPrincipal.Href); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("no calendar home found at %s", start)
+}
+
+// caldavObject is a fetched calendar object resource.
+type caldavObject struct {
+	id           string    // of the whole event
+	url          *url.URL  // as the server listed it
+	recurrenceID time.Time // of the instance the event ID named, if any
+	data         []byte
+	etag         string
+}
+
+// getObject fetches the resource of an event, or of the recurring event an
+// instance ID belongs to.
+func (b *caldavBackend) getObject(ctx context.Context, calendarID, eventID string) (*caldavObject, error) {
+	cal, err := b.calendar(ctx, calendarID)
+	if err != nil {
+		return nil, err
+	}
+	obj := &caldavObject{id: eventID}
+	obj.url, err = b.objectURL(ctx, cal, eventID)
+	if errors.Is(err, errCalDAVNotFound) {
+		if base, recurrenceID, ok := splitInstanceID(eventID); ok {
+			obj = &caldavObject{id: base, recurrenceID: recurrenceID}
+			obj.url, err = b.objectURL(ctx, cal, base)
+		}
+	}
+	if err == nil {
+		err = b.fetchObject(ctx, obj)
+	}
+	if errors.Is(err, errCalDAVNotFound) {
+		return nil, fmt.Errorf("event %s not found", eventID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// objectURL returns where the object of an event lives, listing the
+// calendar's objects when it has not been seen yet.
+func (b *caldavBackend) objectURL(ctx context.Context, cal *caldavCalendar, id string) (*url.URL, error) {
+	if href := cal.href(id); href != nil {
+		return href, nil
+	}
+	responses, err := b.multistatus(ctx, "REPORT", cal.url, "1", `<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/></d:prop>
+  <c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT"/></c:comp-filter></c:filter>
+</c:calendar-query>`)
+	if err != nil {
+		return nil, err
+	}
+	for _, resp := range responses {
+		href, err := cal.url.Parse(resp.Href)
+		if err != nil {
+			return nil, err
+		}
+		cal.setHref(caldavEventID(href), href)
+	}
+	if href := cal.href(id); href != nil {
+		return href, nil
+	}
+	return nil, errCalDAVNotFound
+}
+
+// fetchObject fills in the data and ETag of obj.
+func (b *caldavBackend) fetchObject(ctx context.Context, obj *caldavObject) error {
+	req, err := b.newRequest(ctx, http.MethodGet, obj.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := b.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if obj.data, err = io.ReadAll(resp.Body); err != nil {
+		return err
+	}
+	obj.etag = resp.Header.Get("ETag")
+	return nil
+}
+
+// excludeCalDAVInstance writes the data of obj with the instance at its
+// recurrenceID excluded from the recurrence.
+func excludeCalDAVInstance(obj *caldavObject, w io.Writer) error {
+	vcalendar, err := parseICalendar(bytes.NewReader(obj.data))
+	if err != nil {
+		return err
+	}
+	if _, err := icalInstanceAt(vcalendar.events(), obj.recurrenceID); err != nil {
+		return err
+	}
+	children := vcalendar.Children[:0]
+	for _, child := range vcalendar.Children {
+		if child.Name != "VEVENT" || excludeInstance(child, obj.recurrenceID) {
+			children = append(children, child)
+		}
+	}
+	vcalendar.Children = children
+	return vcalendar.encode(w)
+}
+
+var (
+	errCalDAVNotFound     = errors.New("not found")
+	errCalDAVPrecondition = errors.New("precondition failed")
+)
+
+// multistatus sends a PROPFIND or REPORT and returns the responses with
+// their successfully fetched properties.
+func (b *caldavBackend) multistatus(ctx context.Context, method string, u *url.URL, depth, body string) ([]davResponse, error) {
+	req, err := b.newRequest(ctx, method, u, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", depth)
+	resp, err := b.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("CalDAV %s %s: expected a multistatus, got %s", method, u.Path, resp.Status)
+	}
+
+	var ms davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("CalDAV %s %s: %w", method, u.Path, err)
+	}
+	responses := make([]davResponse, 0, len(ms.Responses))
+	for _, resp := range ms.Responses {
+		for _, propstat := range resp.Propstats {
+			if strings.Contains(propstat.Status, " 200 ") {
+				resp.Prop = propstat.Prop
+			}
+		}
+		responses = append(responses, resp)
+	}
+	return responses, nil
+}
+
+func (b *caldavBackend) newRequest(ctx context.Context, method string, u *url.URL, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if b.username != "" {
+		req.SetBasicAuth(b.username, b.password)
+	}
+	return req, nil
+}
+
+// do sends req, following redirects with the same method and body, and
+// turns error statuses into errors.
+func (b *caldavBackend) do(req *http.Request) (*http.Response, error) {
+	for redirects := 0; ; redirects++ {
+		resp, err := b.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case resp.StatusCode < 300:
+			return resp, nil
+		case resp.StatusCode < 400 && resp.Header.Get("Location") != "" && redirects < 5:
+			resp.Body.Close()
+			location, err := req.URL.Parse(resp.Header.Get("Location"))
+			if err != nil {
+				return nil, err
+			}
+			next := req.Clone(req.Context())
+			next.URL, next.Host = location, ""
+			// Like net/http, keep the credentials from leaking to another host
+			if location.Host != req.URL.Host {
+				next.Header.Del("Authorization")
+			}
+			if req.GetBody != nil {
+				if next.Body, err = req.GetBody(); err != nil {
+					return nil, err
+				}
+			}
+			req = next
+			continue
+		}
+
+		resp.Body.Close()
+		err = fmt.Errorf("CalDAV %s %s: %s", req.Method, req.URL.Path, resp.Status)
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			err = fmt.Errorf("%w: %w", errCalDAVNotFound, err)
+		case http.StatusPreconditionFailed:
+			err = fmt.Errorf("%w: %w", errCalDAVPrecondition, err)
+		}
+		return nil, err
+	}
+}
+
+// caldavEventID returns the event ID of an object resource's href.
+func caldavEventID(href *url.URL) string {
+	return strings.TrimSuffix(path.Base(href.Path), ".ics")
+}
+
+// caldavTimeAttr formats t as an XML attribute of a time-range or expand
+// element, or "" when t is zero.
+func caldavTimeAttr(name string, t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf(` %s="%sZ"`, name, t.UTC().Format(icalDateTimeFormat))
+}
+
+// caldavTimezoneID returns the TZID of the VTIMEZONE in a calendar-timezone
+// property, or "".
+func caldavTimezoneID(data string) string {
+	if data == "" {
+		return ""
+	}
+	vcalendar, err := parseICalendar(strings.NewReader(data))
+	if err != nil {
+		return ""
+	}
+	for _, child := range vcalendar.Children {
+		if child.Name == "VTIMEZONE" {
+			return child.text("TZID")
+		}
+	}
+	return ""
+}
+
+// davMultistatus is a WebDAV multistatus response (RFC 4918).
+type davMultistatus struct {
+	Responses []davResponse `xml:"DAV: response"`
+}
+
+type davResponse struct {
+	Href      string        `xml:"DAV: href"`
+	Propstats []davPropstat `xml:"DAV: propstat"`
+	Prop      davProp       `xml:"-"` // of the successful propstat
+}
+
+type davPropstat struct {
+	Prop   davProp `xml:"DAV: prop"`
+	Status string  `xml:"DAV: status"`
+}
+
+type davProp struct {
+	CurrentUserPrincipal davHref         `xml:"DAV: current-user-principal"`
+	CalendarHomeSet      davHref         `xml:"urn:ietf:params:xml:ns:caldav calendar-home-set"`
+	ResourceType         davResourceType `xml:"DAV: resourcetype"`
+	DisplayName          string          `xml:"DAV: displayname"`
+	ComponentSet         davComponentSet `xml:"urn:ietf:params:xml:ns:caldav supported-calendar-component-set"`
+	CalendarTimezone     string          `xml:"urn:ietf:params:xml:ns:caldav calendar-timezone"`
+	ETag                 string          `xml:"DAV: getetag"`
+	CalendarData         string          `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+}
+
+type davHref struct {
+	Href string `xml:"DAV: href"`
+}
+
+type davResourceType struct {
+	Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+}
+
+type davComponentSet struct {
+	Comps []struct {
+		Name string `xml:"name,attr"`
+	} `xml:"urn:ietf:params:xml:ns:caldav comp"`
+}
+
+// has reports whether the set includes component. Servers omitting the set
+// accept every component.
+func (s davComponentSet) has(component string) bool {
+	if len(s.Comps) == 0 {
+		return true
+	}
+	for _, comp := range s.Comps {
+		if strings.EqualFold(comp.Name, component) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"google-calendar-mcp/fakecaldav"
+)
+
+func TestCalDAVBackend(t *testing.T) {
+	fake := fakecaldav.New("alice", "secret")
+	defer fake.Close()
+
+	// A bare host is discovered through /.well-known/caldav
+	backend, err := newCalDAVBackend(fake.URL, "alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBackend(t, backend)
+}
+
+func TestCalDAVBackendWritesICalendar(t *testing.T) {
+	fake := fakecaldav.New("alice", "secret")
+	defer fake.Close()
+	fake.AddCalendar("work", "Work")
+
+	backend, err := newCalDAVBackend(fake.URL+"/dav/", "alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	calendars, err := backend.ListCalendars(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calendars) != 2 || calendars[0].ID != "personal" || calendars[1].Summary != "Work" || calendars[1].Primary {
+		t.Fatalf("unexpected calendars %+v", calendars)
+	}
+
+	created, err := backend.CreateEvent(context.Background(), "work", &Event{
+		Summary: "Offsite",
+		Start:   EventTime{Time: time.Date(2025, 6, 2, 10, 0, 0, 0, time.UTC)},
+		End:     EventTime{Time: time.Date(2025, 6, 2, 18, 0, 0, 0, time.UTC)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fake.Objects("work")[created.ID+".ics"]
+	if !strings.Contains(data, "UID:"+created.ID) || !strings.Contains(data, "DTSTART:20250602T100000Z") {
+		t.Fatalf("unexpected iCalendar data %q", data)
+	}
+}
+
+func TestCalDAVBackendRedirects(t *testing.T) {
+	var sameHost, otherHost string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		otherHost = r.Header.Get("Authorization")
+	}))
+	defer other.Close()
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/start" {
+			http.Redirect(w, r, "/moved", http.StatusMovedPermanently)
+			return
+		}
+		sameHost = r.Header.Get("Authorization")
+		http.Redirect(w, r, other.URL+"/elsewhere", http.StatusTemporaryRedirect)
+	}))
+	defer origin.Close()
+
+	backend, err := newCalDAVBackend(origin.URL, "alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(origin.URL + "/start")
+	req, err := backend.newRequest(context.Background(), "PROPFIND", u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := backend.do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !strings.HasPrefix(sameHost, "Basic ") {
+		t.Errorf("expected a same-host redirect to keep the credentials, got %q", sameHost)
+	}
+	if otherHost != "" {
+		t.Errorf("expected a redirect to another host to drop the credentials, got %q", otherHost)
+	}
+}
+
+func TestCalDAVBackendRecurringEvents(t *testing.T) {
+	fake := fakecaldav.New("alice", "secret")
+	defer fake.Close()
+	fake.PutObject("personal", "standup.ics", weeklyStandup)
+	backend, err := newCalDAVBackend(fake.URL, "alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	query := EventQuery{TimeMin: time.Date(2025, 6, 14, 0, 0, 0, 0, time.UTC), TimeMax: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)}
+
+	events, err := backend.ListEvents(ctx, "personal", query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].ID != "standup_20250616T070000Z" || events[1].ID != "standup_20250618T070000Z" {
+		t.Fatalf("unexpected instances %+v", events)
+	}
+	event, err := backend.GetEvent(ctx, "personal", events[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !event.Start.Time.Equal(events[1].Start.Time) {
+		t.Fatalf("unexpected instance %+v", event)
+	}
+
+	// Deleting an instance excludes it, deleting the event removes it all
+	if err := backend.DeleteEvent(ctx, "personal", events[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if events, err = backend.ListEvents(ctx, "personal", query); err != nil || len(events) != 1 {
+		t.Fatalf("expected one instance left, got %+v (%v)", events, err)
+	}
+	data := fake.Objects("personal")["standup.ics"]
+	if !strings.Contains(data, "EXDATE;TZID=Europe/Berlin:20250616T090000") {
+		t.Fatalf("expected an EXDATE in %s", data)
+	}
+	if err := backend.DeleteEvent(ctx, "personal", "standup"); err != nil {
+		t.Fatal(err)
+	}
+	if objects := fake.Objects("personal"); len(objects) != 0 {
+		t.Fatalf("expected no events left, got %v", objects)
+	}
+}
+
+func TestCalDAVBackendObjectHrefs(t *testing.T) {
+	fake := fakecaldav.New("alice", "secret")
+	defer fake.Close()
+	// Neither ending in .ics nor right in the calendar collection
+	fake.PutObject("personal", "imported/standup", weeklyStandup)
+	backend, err := newCalDAVBackend(fake.URL, "alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// Found without listing events first
+	event, err := backend.GetEvent(ctx, "personal", "standup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Summary != "Standup" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	events, err := backend.ListEvents(ctx, "personal", EventQuery{TimeMin: time.Date(2025, 6, 14, 0, 0, 0, 0, time.UTC), TimeMax: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)})
+	if err != nil || len(events) != 2 {
+		t.Fatalf("expected two instances, got %+v (%v)", events, err)
+	}
+	if err := backend.DeleteEvent(ctx, "personal", events[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	objects := fake.Objects("personal")
+	if len(objects) != 1 || !strings.Contains(objects["imported/standup"], "EXDATE;TZID=Europe/Berlin:20250616T090000") {
+		t.Fatalf("expected the instance excluded in place, got %v", objects)
+	}
+	if err := backend.DeleteEvent(ctx, "personal", "standup"); err != nil {
+		t.Fatal(err)
+	}
+	if objects := fake.Objects("personal"); len(objects) != 0 {
+		t.Fatalf("expected no events left, got %v", objects)
+	}
+	if _, err := backend.GetEvent(ctx, "personal", "standup"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected the event to be gone, got %v", err)
+	}
+}
+
+func TestNewCalDAVAccount(t *testing.T) {
+	fake := fakecaldav.New("alice", "secret")
+	defer fake.Close()
+
+	if _, err := newCalDAVAccount(context.Background(), fake.URL, "alice", "wrong"); err == nil {
+		t.Fatal("expected a wrong password to fail")
+	}
+	acct, err := newCalDAVAccount(context.Background(), fake.URL, "alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acct.Email != "alice" || !acct.configured() || !hasScope(acct.Scopes, scopeCalendarEvents) {
+		t.Fatalf("unexpected account %+v", acct)
+	}
+}
+
+func TestE2ECalDAVTools(t *testing.T) {
+	env := newTestEnv(t)
+	fake := fakecaldav.New("alice", "secret")
+	defer fake.Close()
+	acct, err := newCalDAVAccount(context.Background(), fake.URL, "alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts.setFallback(acct)
+
+	text, _ := env.call("auth_status", map[string]any{})
+	if !strings.Contains(text, "Method: CalDAV") || strings.Contains(text, "Access token") {
+		t.Fatalf("unexpected auth_status result %q", text)
+	}
+	text, _ = env.call("list_calendars", map[string]any{})
+	if !strings.Contains(text, "Personal (ID: personal)") {
+		t.Fatalf("unexpected list_calendars result %q", text)
+	}
+
+	text, isError := env.call("create_event", map[string]any{
+		"calendar_id": "primary",
+		"summary":     "Review",
+		"start_time":  "2025-06-03T14:00:00Z",
+		"end_time":    "2025-06-03T15:00:00Z",
+	})
+	if isError || !strings.Contains(text, "Event created successfully!") {
+		t.Fatalf("unexpected create_event result %q", text)
+	}
+	objects := fake.Objects("personal")
+	if len(objects) != 1 {
+		t.Fatalf("expected one stored event, got %v", objects)
+	}
+	var eventID string
+	for name := range objects {
+		eventID = strings.TrimSuffix(name, ".ics")
+	}
+
+	text, _ = env.call("list_events", map[string]any{
+		"calendar_id": "primary",
+		"time_min":    "2025-06-03T00:00:00Z",
+		"time_max":    "2025-06-04T00:00:00Z",
+		"max_results": 10,
+	})
+	if !strings.Contains(text, "- Review (2025-06-03T14:00:00Z)") {
+		t.Fatalf("unexpected list_events result %q", text)
+	}
+	text, _ = env.call("get_event", map[string]any{"calendar_id": "primary", "event_id": eventID})
+	if !strings.Contains(text, "Title: Review") {
+		t.Fatalf("unexpected get_event result %q", text)
+	}
+	text, _ = env.call("delete_event", map[string]any{"calendar_id": "primary", "event_id": eventID})
+	if !strings.Contains(text, "deleted successfully") || len(fake.Objects("personal")) != 0 {
+		t.Fatalf("unexpected delete_event result %q", text)
+	}
+
+	if text, isError := env.call("logout", map[string]any{}); !isError || !strings.Contains(text, "CalDAV") {
+		t.Fatalf("expected logout to refuse, got %q", text)
+	}
+}
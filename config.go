@@ -0,0 +1,422 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// config is everything the server is configured with. loadConfig fills it
+// from defaults, a YAML or JSON config file, the environment and flags, each
+// overriding the ones before.
+type config struct {
+	Transport             string        `yaml:"transport"`       // "http" or "stdio"
+	Host                  string        `yaml:"host"`            // to listen on
+	Port                  int           `yaml:"port"`            // to listen on
+	AdvertisedHost        string        `yaml:"advertised_host"` // for the default base URL
+	BaseURL               string        `yaml:"base_url"`        // at which clients reach the server
+	Transports            []string      `yaml:"transports"`      // served over HTTP
+	ShutdownTimeout       time.Duration `yaml:"shutdown_timeout"`
+	ReadyCheckCalendarAPI bool          `yaml:"ready_check_calendar_api"`
+	Tools                 []string      `yaml:"tools"` // to offer; empty for all
+	FakeGoogle            bool          `yaml:"fake_google"`
+
+	OAuth struct {
+		ClientFile       string        `yaml:"client_file"` // client_secret.json
+		ClientID         string        `yaml:"client_id"`
+		ClientSecret     string        `yaml:"client_secret"`
+		ClientSecretFile string        `yaml:"client_secret_file"`
+		Flow             string        `yaml:"flow"`
+		Scopes           []string      `yaml:"scopes"` // asked for first
+		CallbackPort     int           `yaml:"callback_port"`
+		WaitTimeout      time.Duration `yaml:"wait_timeout"`
+	} `yaml:"oauth"`
+
+	MCPAuth struct {
+		Required  bool     `yaml:"required"`
+		Audiences []string `yaml:"audiences"` // besides the OAuth client ID
+	} `yaml:"mcp_auth"`
+
+	TokenStore struct {
+		Path    string `yaml:"path"`
+		Key     string `yaml:"key"` // base64, 32 bytes
+		KeyFile string `yaml:"key_file"`
+	} `yaml:"token_store"`
+
+	ServiceAccount struct {
+		File               string `yaml:"file"`
+		ImpersonateSubject string `yaml:"impersonate_subject"`
+	} `yaml:"service_account"`
+
+	CalDAV struct {
+		URL          string `yaml:"url"`
+		Username     string `yaml:"username"`
+		Password     string `yaml:"password"`
+		PasswordFile string `yaml:"password_file"`
+	} `yaml:"caldav"`
+
+	LocalCalendarPath string `yaml:"local_calendar_path"`
+
+	Endpoints googleEndpoints `yaml:"google_endpoints"`
+}
+
+// toolNames lists the tools setupTools defines, which config.Tools picks
+// from.
+var toolNames = []string{
+	"auth",
+	"auth_status",
+	"logout",
+	"get_current_time",
+	"list_calendars",
+	"list_events",
+	"create_event",
+	"get_event",
+	"delete_event",
+}
+
+// enabledTools are the tools newMCPServer offers, or empty for all of them.
+var enabledTools []string
+
+func defaultConfig() *config {
+	c := &config{
+		Transport:       "http",
+		Host:            "localhost",
+		Port:            5555,
+		AdvertisedHost:  "localhost",
+		Transports:      slices.Clone(httpTransports),
+		ShutdownTimeout: shutdownTimeout,
+	}
+	c.OAuth.Flow = oauthFlowRedirect
+	c.OAuth.Scopes = slices.Clone(readScopes)
+	c.OAuth.WaitTimeout = authWaitTimeout
+	return c
+}
+
+// setting is a config field that can be set from the environment and,
+// unless flag is empty, from the command line. Secrets have no flag, since
+// process listings show the command line to everyone.
+type setting struct {
+	env   string
+	flag  string
+	help  string
+	value settingValue
+}
+
+// settingValue parses a setting into its config field.
+type settingValue struct {
+	set     func(value string) error
+	boolean bool // for flags that need no value
+}
+
+func (c *config) settings() []setting {
+	return []setting{
+		{"", "transport", `how MCP clients connect: "http" to serve them on HOST:PORT, or "stdio" for a client that launched the server`, setString(&c.Transport)},
+		{"HOST", "host", "host to listen on", setString(&c.Host)},
+		{"PORT", "port", "port to listen on", setInt(&c.Port)},
+		{"ADVERTISED_HOST", "advertised-host", "host clients connect to, for the default base URL", setString(&c.AdvertisedHost)},
+		{"BASE_URL", "base-url", "URL at which clients reach the server, by default http://ADVERTISED_HOST:PORT", setString(&c.BaseURL)},
+		{"MCP_TRANSPORTS", "transports", `comma-separated transports to serve over HTTP: "sse" and/or "streamable-http"`, setList(&c.Transports)},
+		{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "how long shutting down waits for tool calls", setDuration(&c.ShutdownTimeout)},
+		{"READY_CHECK_CALENDAR_API", "ready-check-calendar-api", "make /readyz check that the Calendar API answers", setBool(&c.ReadyCheckCalendarAPI)},
+		{"ENABLED_TOOLS", "tools", "comma-separated tools to offer, all by default", setList(&c.Tools)},
+		{"FAKE_GOOGLE", "fake-google", "serve a fake Google in the same process, for demos; needs a build with -tags fakegoogle", setBool(&c.FakeGoogle)},
+		{"GOOGLE_OAUTH_CLIENT_FILE", "oauth-client-file", "client_secret.json of the OAuth client, as downloaded from the Google Cloud console", setString(&c.OAuth.ClientFile)},
+		{"GOOGLE_CLIENT_ID", "google-client-id", "OAuth client ID", setString(&c.OAuth.ClientID)},
+		{"GOOGLE_CLIENT_SECRET", "", "", setString(&c.OAuth.ClientSecret)},
+		{"GOOGLE_CLIENT_SECRET_FILE", "google-client-secret-file", "file holding the OAuth client secret", setString(&c.OAuth.ClientSecretFile)},
+		{"OAUTH_FLOW", "oauth-flow", `"redirect" or "device"`, setString(&c.OAuth.Flow)},
+		{"GOOGLE_SCOPES", "scopes", "comma-separated scopes sessions are first asked for", setList(&c.OAuth.Scopes)},
+		{"OAUTH_CALLBACK_PORT", "oauth-callback-port", "loopback port for the OAuth callback with --transport=stdio, any free one by default", setInt(&c.OAuth.CallbackPort)},
+		{"AUTH_WAIT_TIMEOUT", "auth-wait-timeout", "how long the auth tool waits for consent; 0 returns the URL right away", setDuration(&c.OAuth.WaitTimeout)},
+		{"MCP_AUTH_REQUIRED", "mcp-auth-required", "require Google bearer tokens on the MCP endpoints", setBool(&c.MCPAuth.Required)},
+		{"MCP_AUTH_AUDIENCES", "mcp-auth-audiences", "comma-separated client IDs accepted in bearer tokens besides the OAuth client's", setList(&c.MCPAuth.Audiences)},
+		{"TOKEN_STORE_PATH", "token-store-path", "file to persist tokens in, instead of memory only", setString(&c.TokenStore.Path)},
+		{"TOKEN_STORE_KEY", "", "", setString(&c.TokenStore.Key)},
+		{"TOKEN_STORE_KEY_FILE", "token-store-key-file", "file holding the token store key", setString(&c.TokenStore.KeyFile)},
+		{"GOOGLE_SERVICE_ACCOUNT_FILE", "service-account-file", "service-account JSON key to act through", setString(&c.ServiceAccount.File)},
+		{"GOOGLE_IMPERSONATE_SUBJECT", "impersonate-subject", "user the service account acts as", setString(&c.ServiceAccount.ImpersonateSubject)},
+		{"CALDAV_URL", "caldav-url", "CalDAV server to use instead of Google", setString(&c.CalDAV.URL)},
+		{"CALDAV_USERNAME", "caldav-username", "CalDAV user", setString(&c.CalDAV.Username)},
+		{"CALDAV_PASSWORD", "", "", setString(&c.CalDAV.Password)},
+		{"CALDAV_PASSWORD_FILE", "caldav-password-file", "file holding the CalDAV password", setString(&c.CalDAV.PasswordFile)},
+		{"LOCAL_CALENDAR_PATH", "local-calendar-path", "local .ics files and vdir directories to use instead of Google, separated like PATH", setString(&c.LocalCalendarPath)},
+		{"GOOGLE_AUTH_URL", "google-auth-url", "OAuth authorization endpoint instead of Google's", setString(&c.Endpoints.AuthURL)},
+		{"GOOGLE_TOKEN_URL", "google-token-url", "OAuth token endpoint instead of Google's", setString(&c.Endpoints.TokenURL)},
+		{"GOOGLE_DEVICE_AUTH_URL", "google-device-auth-url", "OAuth device authorization endpoint instead of Google's", setString(&c.Endpoints.DeviceAuthURL)},
+		{"GOOGLE_USERINFO_URL", "google-userinfo-url", "OpenID Connect userinfo endpoint instead of Google's", setString(&c.Endpoints.UserInfoURL)},
+		{"GOOGLE_REVOKE_URL", "google-revoke-url", "OAuth token revocation endpoint instead of Google's", setString(&c.Endpoints.RevokeURL)},
+		{"GOOGLE_TOKENINFO_URL", "google-tokeninfo-url", "token info endpoint instead of Google's", setString(&c.Endpoints.TokenInfoURL)},
+		{"GOOGLE_CALENDAR_API_URL", "google-calendar-api-url", "Calendar API base path instead of Google's", setString(&c.Endpoints.CalendarAPIURL)},
+	}
+}
+
+// loadConfig returns the configuration from args, the command-line flags,
+// and getenv, together with the config file named by --config or
+// CONFIG_FILE. Flags take precedence over the environment, which takes
+// precedence over the file. Secrets are read from their files, and the
+// result is validated.
+func loadConfig(args []string, getenv func(string) string) (*config, error) {
+	c := defaultConfig()
+	settings := c.settings()
+
+	// Flags are applied last, once the file and environment are
+	flags := flag.NewFlagSet("google-calendar-mcp", flag.ContinueOnError)
+	configFile := flags.String("config", getenv("CONFIG_FILE"), "YAML or JSON config file (or CONFIG_FILE)")
+	var fromFlags []func() error
+	for _, s := range settings {
+		if s.flag == "" {
+			continue
+		}
+		usage := s.help
+		if s.env != "" {
+			usage += " (or " + s.env + ")"
+		}
+		record := func(value string) error {
+			fromFlags = append(fromFlags, func() error {
+				if err := s.value.set(value); err != nil {
+					return fmt.Errorf("--%s: %w", s.flag, err)
+				}
+				return nil
+			})
+			return nil
+		}
+		if s.value.boolean {
+			flags.BoolFunc(s.flag, usage, record)
+		} else {
+			flags.Func(s.flag, usage, record)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		if err := c.loadFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+	c.preferSecrets(func(env string) bool { return getenv(env) != "" })
+	for _, s := range settings {
+		if value := getenv(s.env); s.env != "" && value != "" {
+			if err := s.value.set(value); err != nil {
+				return nil, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+	setFlags := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+	c.preferSecrets(func(env string) bool {
+		for _, s := range settings {
+			if s.env == env {
+				return s.flag != "" && setFlags[s.flag]
+			}
+		}
+		return false
+	})
+	for _, set := range fromFlags {
+		if err := set(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.readSecrets(); err != nil {
+		return nil, err
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// loadFile sets the fields path sets. JSON being YAML, it reads either;
+// unknown fields are refused, as they are most likely misspelled.
+func (c *config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to read the config file: %w", err)
+	}
+	defer f.Close()
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// validate checks the settings against each other and fills in the base URL
+// unless set. It reports every problem at once.
+func (c *config) validate() error {
+	var errs []error
+	problem := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.Transport != "http" && c.Transport != "stdio" {
+		problem(`transport must be "http" or "stdio", got %q`, c.Transport)
+	}
+	if c.Host == "" {
+		problem("host (HOST) must not be empty")
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		problem("port (PORT) must be between 1 and 65535, got %d", c.Port)
+	}
+	if c.BaseURL == "" {
+		c.BaseURL = fmt.Sprintf("http://%s", net.JoinHostPort(c.AdvertisedHost, strconv.Itoa(c.Port)))
+	}
+	c.BaseURL = strings.TrimSuffix(c.BaseURL, "/")
+	if u, err := url.Parse(c.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problem("base_url (BASE_URL) must be an http or https URL, got %q", c.BaseURL)
+	}
+	if len(c.Transports) == 0 {
+		problem("transports (MCP_TRANSPORTS) must not be empty")
+	}
+	for _, transport := range c.Transports {
+		if transport != transportSSE && transport != transportStreamable {
+			problem("transports (MCP_TRANSPORTS) must list %q and/or %q, got %q", transportSSE, transportStreamable, transport)
+		}
+	}
+	if c.ShutdownTimeout <= 0 {
+		problem("shutdown_timeout (SHUTDOWN_TIMEOUT) must be positive, got %s", c.ShutdownTimeout)
+	}
+
+	// A configured account stands in for OAuth altogether
+	var fallbacks []string
+	if c.ServiceAccount.File != "" {
+		fallbacks = append(fallbacks, "service_account.file (GOOGLE_SERVICE_ACCOUNT_FILE)")
+	}
+	if c.CalDAV.URL != "" {
+		fallbacks = append(fallbacks, "caldav.url (CALDAV_URL)")
+	}
+	if c.LocalCalendarPath != "" {
+		fallbacks = append(fallbacks, "local_calendar_path (LOCAL_CALENDAR_PATH)")
+	}
+	if len(fallbacks) > 1 {
+		problem("only one of %s can be set", strings.Join(fallbacks, ", "))
+	}
+	if c.OAuth.ClientID == "" && !c.FakeGoogle && len(fallbacks) == 0 {
+		problem("oauth.client_id (GOOGLE_CLIENT_ID) or oauth.client_file (GOOGLE_OAUTH_CLIENT_FILE) is required unless %s is set",
+			"service_account.file (GOOGLE_SERVICE_ACCOUNT_FILE), caldav.url (CALDAV_URL), local_calendar_path (LOCAL_CALENDAR_PATH) or fake_google (FAKE_GOOGLE)")
+	}
+	if c.ServiceAccount.ImpersonateSubject != "" && c.ServiceAccount.File == "" {
+		problem("service_account.impersonate_subject (GOOGLE_IMPERSONATE_SUBJECT) requires service_account.file (GOOGLE_SERVICE_ACCOUNT_FILE)")
+	}
+
+	if c.OAuth.Flow != oauthFlowRedirect && c.OAuth.Flow != oauthFlowDevice {
+		problem("oauth.flow (OAUTH_FLOW) must be %q or %q, got %q", oauthFlowRedirect, oauthFlowDevice, c.OAuth.Flow)
+	}
+	if !slices.Contains(c.OAuth.Scopes, scopeEmail) {
+		problem("oauth.scopes (GOOGLE_SCOPES) must include %s, which identifies accounts", scopeEmail)
+	}
+	if !hasScope(c.OAuth.Scopes, scopeCalendarReadonly) {
+		problem("oauth.scopes (GOOGLE_SCOPES) must include %s or %s", scopeCalendarReadonly, scopeCalendar)
+	}
+	if c.OAuth.CallbackPort < 0 || c.OAuth.CallbackPort > 65535 {
+		problem("oauth.callback_port (OAUTH_CALLBACK_PORT) must be between 0 and 65535, got %d", c.OAuth.CallbackPort)
+	}
+	if c.OAuth.WaitTimeout < 0 {
+		problem("oauth.wait_timeout (AUTH_WAIT_TIMEOUT) must not be negative, got %s", c.OAuth.WaitTimeout)
+	}
+	if c.MCPAuth.Required && c.Transport == "stdio" {
+		problem("mcp_auth.required (MCP_AUTH_REQUIRED) only applies to --transport=http")
+	}
+
+	for _, tool := range c.Tools {
+		if !slices.Contains(toolNames, tool) {
+			problem("tools (ENABLED_TOOLS) must list some of %s, got %q", strings.Join(toolNames, ", "), tool)
+		}
+	}
+	if len(c.Tools) > 0 && !slices.Contains(c.Tools, "auth") && len(fallbacks) == 0 {
+		problem("tools (ENABLED_TOOLS) must include auth, which users need to sign in")
+	}
+
+	if c.TokenStore.Path != "" && c.TokenStore.Key == "" {
+		problem("token_store.key (TOKEN_STORE_KEY) is required when token_store.path (TOKEN_STORE_PATH) is set")
+	}
+
+	for _, endpoint := range []struct{ name, url string }{
+		{"google_endpoints.auth_url (GOOGLE_AUTH_URL)", c.Endpoints.AuthURL},
+		{"google_endpoints.token_url (GOOGLE_TOKEN_URL)", c.Endpoints.TokenURL},
+		{"google_endpoints.device_auth_url (GOOGLE_DEVICE_AUTH_URL)", c.Endpoints.DeviceAuthURL},
+		{"google_endpoints.userinfo_url (GOOGLE_USERINFO_URL)", c.Endpoints.UserInfoURL},
+		{"google_endpoints.revoke_url (GOOGLE_REVOKE_URL)", c.Endpoints.RevokeURL},
+		{"google_endpoints.tokeninfo_url (GOOGLE_TOKENINFO_URL)", c.Endpoints.TokenInfoURL},
+		{"google_endpoints.calendar_api_url (GOOGLE_CALENDAR_API_URL)", c.Endpoints.CalendarAPIURL},
+	} {
+		if endpoint.url == "" {
+			continue
+		}
+		if u, err := url.Parse(endpoint.url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problem("%s must be an http or https URL, got %q", endpoint.name, endpoint.url)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// listenAddr is the address to serve HTTP on.
+func (c *config) listenAddr() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+func setString(p *string) settingValue {
+	return settingValue{set: func(value string) error {
+		*p = value
+		return nil
+	}}
+}
+
+func setInt(p *int) settingValue {
+	return settingValue{set: func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		*p = n
+		return nil
+	}}
+}
+
+func setBool(p *bool) settingValue {
+	return settingValue{boolean: true, set: func(value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		*p = b
+		return nil
+	}}
+}
+
+func setDuration(p *time.Duration) settingValue {
+	return settingValue{set: func(value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a valid duration", value)
+		}
+		*p = d
+		return nil
+	}}
+}
+
+// setList sets a comma-separated list.
+func setList(p *[]string) settingValue {
+	return settingValue{set: func(value string) error {
+		*p = nil
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*p = append(*p, item)
+			}
+		}
+		return nil
+	}}
+}
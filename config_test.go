@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// envOf returns a getenv over vars.
+func envOf(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	c, err := loadConfig(nil, envOf(map[string]string{"GOOGLE_CLIENT_ID": "client"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.listenAddr() != "localhost:5555" || c.BaseURL != "http://localhost:5555" || c.Transport != "http" {
+		t.Errorf("unexpected defaults: listen %s, base URL %s, transport %s", c.listenAddr(), c.BaseURL, c.Transport)
+	}
+	if c.OAuth.Flow != oauthFlowRedirect || !slices.Equal(c.OAuth.Scopes, readScopes) || c.Tools != nil {
+		t.Errorf("unexpected OAuth defaults: %+v, tools %v", c.OAuth, c.Tools)
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+port: 7000
+advertised_host: calendar.example.com
+oauth:
+  client_id: from-file
+  client_secret: file-secret
+  wait_timeout: 1m
+tools: [auth, list_events]
+token_store:
+  path: /var/lib/tokens.json
+  key: a2V5
+google_endpoints:
+  calendar_api_url: http://localhost:8080/calendar/v3/
+  userinfo_url: http://localhost:8080/userinfo
+`)
+	env := envOf(map[string]string{
+		"CONFIG_FILE":      path,
+		"GOOGLE_CLIENT_ID": "from-env",
+		"PORT":             "8000",
+		"ENABLED_TOOLS":    "auth, list_calendars",
+	})
+	c, err := loadConfig([]string{"--port=9000", "--mcp-auth-required", "--google-userinfo-url=http://localhost:9090/userinfo"}, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Port != 9000 || c.OAuth.ClientID != "from-env" || c.OAuth.ClientSecret != "file-secret" || !c.MCPAuth.Required {
+		t.Errorf("expected flags over env over file, got port %d, client %q, secret %q, auth required %v", c.Port, c.OAuth.ClientID, c.OAuth.ClientSecret, c.MCPAuth.Required)
+	}
+	if c.BaseURL != "http://calendar.example.com:9000" || c.OAuth.WaitTimeout != time.Minute || c.TokenStore.Path != "/var/lib/tokens.json" {
+		t.Errorf("unexpected base URL %s, wait timeout %s, token store %s", c.BaseURL, c.OAuth.WaitTimeout, c.TokenStore.Path)
+	}
+	if !slices.Equal(c.Tools, []string{"auth", "list_calendars"}) {
+		t.Errorf("expected the tools from the environment, got %v", c.Tools)
+	}
+	if c.Endpoints.CalendarAPIURL != "http://localhost:8080/calendar/v3/" || c.Endpoints.UserInfoURL != "http://localhost:9090/userinfo" || c.Endpoints.TokenURL != "" {
+		t.Errorf("unexpected endpoints %+v", c.Endpoints)
+	}
+}
+
+func TestLoadConfigJSONFile(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{"base_url": "https://calendar.example.com/", "oauth": {"client_id": "client", "flow": "device"}}`)
+	c, err := loadConfig([]string{"--config", path}, envOf(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.BaseURL != "https://calendar.example.com" || c.OAuth.Flow != oauthFlowDevice {
+		t.Errorf("unexpected base URL %s, flow %s", c.BaseURL, c.OAuth.Flow)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		args []string
+		env  map[string]string
+		file string
+		want []string
+	}{
+		{
+			name: "missing client ID",
+			want: []string{"oauth.client_id (GOOGLE_CLIENT_ID) or oauth.client_file (GOOGLE_OAUTH_CLIENT_FILE) is required"},
+		},
+		{
+			name: "every problem at once",
+			env:  map[string]string{"GOOGLE_CLIENT_ID": "client", "OAUTH_FLOW": "popup", "MCP_TRANSPORTS": "websocket", "ENABLED_TOOLS": "list_events,send_email"},
+			args: []string{"--port=0"},
+			want: []string{"port (PORT)", "oauth.flow (OAUTH_FLOW)", `got "websocket"`, `got "send_email"`, "must include auth"},
+		},
+		{
+			name: "several accounts",
+			env:  map[string]string{"CALDAV_URL": "https://dav.example.com", "LOCAL_CALENDAR_PATH": "/tmp/cal.ics"},
+			want: []string{"only one of caldav.url (CALDAV_URL), local_calendar_path (LOCAL_CALENDAR_PATH) can be set"},
+		},
+		{
+			name: "scopes without calendar access",
+			env:  map[string]string{"GOOGLE_CLIENT_ID": "client", "GOOGLE_SCOPES": scopeEmail},
+			want: []string{"oauth.scopes (GOOGLE_SCOPES) must include " + scopeCalendarReadonly},
+		},
+		{
+			name: "token store without key",
+			env:  map[string]string{"GOOGLE_CLIENT_ID": "client", "TOKEN_STORE_PATH": "/var/lib/tokens.json"},
+			want: []string{"token_store.key (TOKEN_STORE_KEY) is required"},
+		},
+		{
+			name: "bearer tokens over stdio",
+			env:  map[string]string{"GOOGLE_CLIENT_ID": "client"},
+			args: []string{"--transport=stdio", "--mcp-auth-required"},
+			want: []string{"only applies to --transport=http"},
+		},
+		{
+			name: "invalid endpoint",
+			env:  map[string]string{"GOOGLE_CLIENT_ID": "client", "GOOGLE_TOKEN_URL": "localhost:8080/token"},
+			want: []string{`google_endpoints.token_url (GOOGLE_TOKEN_URL) must be an http or https URL, got "localhost:8080/token"`},
+		},
+		{
+			name: "invalid environment value",
+			env:  map[string]string{"SHUTDOWN_TIMEOUT": "soon"},
+			want: []string{`SHUTDOWN_TIMEOUT: "soon" is not a valid duration`},
+		},
+		{
+			name: "invalid flag value",
+			env:  map[string]string{"GOOGLE_CLIENT_ID": "client"},
+			args: []string{"--fake-google=maybe"},
+			want: []string{`--fake-google: "maybe" is not true or false`},
+		},
+		{
+			name: "misspelled file field",
+			file: "oauth:\n  clientid: client\n",
+			want: []string{"field clientid not found"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := tc.env
+			if tc.file != "" {
+				env = map[string]string{"CONFIG_FILE": writeConfigFile(t, "config.yaml", tc.file)}
+			}
+			_, err := loadConfig(tc.args, envOf(env))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected %q in error %q", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestEnabledTools(t *testing.T) {
+	t.Cleanup(func() { enabledTools = nil })
+	// Each case gets its own server, closed before the next one swaps the
+	// globals
+	listTools := func(t *testing.T) []string {
+		env := newTestEnv(t)
+		result, err := env.client.ListTools(context.Background(), mcp.ListToolsRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, tool := range result.Tools {
+			names = append(names, tool.Name)
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	// toolNames has to keep up with setupTools
+	t.Run("all", func(t *testing.T) {
+		if got, want := listTools(t), slices.Sorted(slices.Values(toolNames)); !slices.Equal(got, want) {
+			t.Fatalf("toolNames is %v, but the server defines %v", want, got)
+		}
+	})
+
+	// An empty list, as "tools: []" in a config file gives, offers them all
+	t.Run("empty", func(t *testing.T) {
+		path := writeConfigFile(t, "config.yaml", "oauth:\n  client_id: client\ntools: []\n")
+		c, err := loadConfig([]string{"--config", path}, envOf(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		enabledTools = c.Tools
+		if got := listTools(t); len(got) != len(toolNames) {
+			t.Fatalf("expected all of %v, got %v", toolNames, got)
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		enabledTools = []string{"auth", "list_events"}
+		if got := listTools(t); !slices.Equal(got, enabledTools) {
+			t.Fatalf("expected only %v, got %v", enabledTools, got)
+		}
+	})
+}
@@ -0,0 +1,27 @@
+//go:build fakegoogle
+
+package main
+
+import (
+	"log"
+
+	"google-calendar-mcp/fakegoogle"
+)
+
+// startFakeGoogle serves a fake Google in the same process, for demos
+// without credentials, and returns its endpoints. Only builds with
+// -tags fakegoogle include it, keeping the fake out of production binaries.
+func startFakeGoogle() (googleEndpoints, error) {
+	fake := fakegoogle.New()
+	log.Printf("Using fake Google at %s, signing in as %s", fake.URL, fakegoogle.DefaultUser.Email)
+	endpoint := fake.Endpoint()
+	return googleEndpoints{
+		AuthURL:        endpoint.AuthURL,
+		TokenURL:       endpoint.TokenURL,
+		DeviceAuthURL:  endpoint.DeviceAuthURL,
+		UserInfoURL:    fake.UserInfoURL(),
+		RevokeURL:      fake.RevokeURL(),
+		TokenInfoURL:   fake.TokenInfoURL(),
+		CalendarAPIURL: fake.CalendarURL(),
+	}, nil
+}
@@ -0,0 +1,11 @@
+//go:build !fakegoogle
+
+package main
+
+import "errors"
+
+// startFakeGoogle fails in builds without the fake Google; demos need
+// -tags fakegoogle.
+func startFakeGoogle() (googleEndpoints, error) {
+	return googleEndpoints{}, errors.New("this build has no fake Google; build with -tags fakegoogle")
+}
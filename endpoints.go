@@ -0,0 +1,78 @@
+package main
+
+import (
+	"cmp"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+)
+
+// Google endpoints the server talks to besides the OAuth endpoint in
+// oauthConfig. configureEndpoints points them elsewhere, e.g. at a fake.
+var (
+	googleUserInfoURL  = "https://openidconnect.googleapis.com/v1/userinfo"
+	googleRevokeURL    = "https://oauth2.googleapis.com/revoke"
+	googleTokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+	calendarAPIURL     = "" // empty uses the Calendar client's default
+)
+
+// defaultCalendarAPIURL is the Calendar client's default endpoint.
+const defaultCalendarAPIURL = "https://www.googleapis.com/calendar/v3/"
+
+// googleEndpoints are URLs to use instead of Google's; empty ones keep
+// Google's.
+type googleEndpoints struct {
+	AuthURL        string `yaml:"auth_url"`
+	TokenURL       string `yaml:"token_url"`
+	DeviceAuthURL  string `yaml:"device_auth_url"`
+	UserInfoURL    string `yaml:"userinfo_url"`
+	RevokeURL      string `yaml:"revoke_url"`
+	TokenInfoURL   string `yaml:"tokeninfo_url"`
+	CalendarAPIURL string `yaml:"calendar_api_url"` // Calendar API base path
+}
+
+// or returns e with its empty URLs taken from defaults.
+func (e googleEndpoints) or(defaults googleEndpoints) googleEndpoints {
+	return googleEndpoints{
+		AuthURL:        cmp.Or(e.AuthURL, defaults.AuthURL),
+		TokenURL:       cmp.Or(e.TokenURL, defaults.TokenURL),
+		DeviceAuthURL:  cmp.Or(e.DeviceAuthURL, defaults.DeviceAuthURL),
+		UserInfoURL:    cmp.Or(e.UserInfoURL, defaults.UserInfoURL),
+		RevokeURL:      cmp.Or(e.RevokeURL, defaults.RevokeURL),
+		TokenInfoURL:   cmp.Or(e.TokenInfoURL, defaults.TokenInfoURL),
+		CalendarAPIURL: cmp.Or(e.CalendarAPIURL, defaults.CalendarAPIURL),
+	}
+}
+
+// configureEndpoints returns the OAuth endpoint to use and sets the other
+// Google endpoints, taking the URLs set in endpoints instead of Google's.
+func configureEndpoints(endpoints googleEndpoints) oauth2.Endpoint {
+	endpoint := google.Endpoint
+	overrides := []struct {
+		from string
+		url  *string
+	}{
+		{endpoints.AuthURL, &endpoint.AuthURL},
+		{endpoints.TokenURL, &endpoint.TokenURL},
+		{endpoints.DeviceAuthURL, &endpoint.DeviceAuthURL},
+		{endpoints.UserInfoURL, &googleUserInfoURL},
+		{endpoints.RevokeURL, &googleRevokeURL},
+		{endpoints.TokenInfoURL, &googleTokenInfoURL},
+		{endpoints.CalendarAPIURL, &calendarAPIURL},
+	}
+	for _, override := range overrides {
+		if override.from != "" {
+			*override.url = override.from
+		}
+	}
+	return endpoint
+}
+
+// calendarOptions adds the configured Calendar API endpoint to opts.
+func calendarOptions(opts ...option.ClientOption) []option.ClientOption {
+	if calendarAPIURL != "" {
+		opts = append(opts, option.WithEndpoint(calendarAPIURL))
+	}
+	return opts
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/server"
+	"golang.org/x/oauth2"
+
+	"google-calendar-mcp/fakegoogle"
+)
+
+func TestAuthorizationAgainstFakeGoogle(t *testing.T) {
+	fake := fakegoogle.New()
+	defer fake.Close()
+	defer func(userInfo, revoke, tokenInfo, calendarAPI string) {
+		googleUserInfoURL, googleRevokeURL, googleTokenInfoURL, calendarAPIURL = userInfo, revoke, tokenInfo, calendarAPI
+	}(googleUserInfoURL, googleRevokeURL, googleTokenInfoURL, calendarAPIURL)
+
+	callback := httptest.NewServer(handleAuthCallback(server.NewMCPServer("test", "0.0.0")))
+	defer callback.Close()
+	oauthConfig = &oauth2.Config{
+		ClientID:    "fake-client-id",
+		RedirectURL: callback.URL,
+		Endpoint:    configureEndpoints(fakeEndpoints(fake)),
+	}
+
+	url, err := authorizationURL(authTarget{Principal: "session-fake", SessionID: "session-fake", Scopes: readScopes}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the callback to succeed, got %s", resp.Status)
+	}
+
+	acct := accounts.forPrincipal("session-fake")
+	if acct == nil || acct.Email != fakegoogle.DefaultUser.Email {
+		t.Fatalf("expected %s to be linked, got %+v", fakegoogle.DefaultUser.Email, acct)
+	}
+	calendars, err := acct.Backend.ListCalendars(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calendars) != 1 || calendars[0].ID != fakegoogle.DefaultUser.Email {
+		t.Fatalf("unexpected calendars: %+v", calendars)
+	}
+	accounts.remove(acct.ID)
+}
@@ -0,0 +1,376 @@
+// Package fakecaldav is an in-process stand-in for a CalDAV server (RFC
+// 4791), such as Nextcloud or Fastmail, so the CalDAV backend can be
+// exercised in tests and local demos without a real one.
+//
+// It serves one user behind HTTP basic auth: discovery through
+// /.well-known/caldav, the current-user-principal and calendar-home-set
+// properties, calendar-query REPORTs with time-range filters, and GET, PUT
+// and DELETE of calendar object resources with ETag preconditions. Time
+// ranges are matched on DTSTART and DTEND only, recurring events match any
+// range after they start, and REPORTs ignore the expand element, returning
+// the stored objects as they are.
+package fakecaldav
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// utcTimezone is the calendar-timezone of every calendar.
+const utcTimezone = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//fakecaldav//EN\r\nBEGIN:VTIMEZONE\r\nTZID:UTC\r\nBEGIN:STANDARD\r\nDTSTART:19700101T000000\r\nTZOFFSETFROM:+0000\r\nTZOFFSETTO:+0000\r\nEND:STANDARD\r\nEND:VTIMEZONE\r\nEND:VCALENDAR\r\n"
+
+// Server is a running fake CalDAV server. Point the backend at URL.
+type Server struct {
+	URL      string
+	Username string
+	Password string
+
+	srv *httptest.Server
+
+	mu        sync.Mutex
+	calendars []*fakeCalendar
+}
+
+type fakeCalendar struct {
+	name        string
+	displayName string
+	objects     map[string]*object // by resource name, e.g. "abc.ics"
+}
+
+type object struct {
+	data string
+	etag string
+}
+
+// New starts a fake server for username and password with one calendar,
+// "personal". Call Close when done.
+func New(username, password string) *Server {
+	s := &Server{Username: username, Password: password}
+	s.AddCalendar("personal", "Personal")
+
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// AddCalendar adds a calendar collection to the user's calendar home.
+func (s *Server) AddCalendar(name, displayName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calendars = append(s.calendars, &fakeCalendar{name: name, displayName: displayName, objects: make(map[string]*object)})
+}
+
+// Objects returns the iCalendar data of a calendar by resource name.
+func (s *Server) Objects(calendarName string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objects := make(map[string]string)
+	if cal := s.calendar(calendarName); cal != nil {
+		for name, obj := range cal.objects {
+			objects[name] = obj.data
+		}
+	}
+	return objects
+}
+
+// PutObject stores data as the resource called name in a calendar, the way
+// another client of the server would.
+func (s *Server) PutObject(calendarName, name, data string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cal := s.calendar(calendarName); cal != nil {
+		cal.objects[name] = newObject(data)
+	}
+}
+
+func (s *Server) principalPath() string { return "/dav/principals/" + s.Username + "/" }
+func (s *Server) homePath() string      { return "/dav/calendars/" + s.Username + "/" }
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/.well-known/caldav" {
+		http.Redirect(w, r, "/dav/", http.StatusMovedPermanently)
+		return
+	}
+	if username, password, ok := r.BasicAuth(); !ok || username != s.Username || password != s.Password {
+		w.Header().Set("WWW-Authenticate", `Basic realm="fakecaldav"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := r.URL.Path
+	switch {
+	case r.Method == "PROPFIND" && (path == "/dav/" || path == s.principalPath()):
+		s.propfindPrincipal(w, path)
+	case r.Method == "PROPFIND" && path == s.homePath():
+		s.propfindHome(w, r)
+	case strings.HasPrefix(path, s.homePath()):
+		name, resource, _ := strings.Cut(strings.TrimPrefix(path, s.homePath()), "/")
+		cal := s.calendar(name)
+		if cal == nil {
+			http.Error(w, "no such calendar", http.StatusNotFound)
+			return
+		}
+		switch {
+		case resource == "" && r.Method == "PROPFIND":
+			s.writeMultistatus(w, []response{s.calendarResponse(cal)})
+		case resource == "" && r.Method == "REPORT":
+			s.report(w, r, cal)
+		case resource != "":
+			s.serveObject(w, r, cal, resource)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func (s *Server) propfindPrincipal(w http.ResponseWriter, path string) {
+	s.writeMultistatus(w, []response{{
+		Href: path,
+		Propstat: propstat{Prop: prop{
+			CurrentUserPrincipal: &href{Href: s.principalPath()},
+			CalendarHomeSet:      &href{Href: s.homePath()},
+		}},
+	}})
+}
+
+func (s *Server) propfindHome(w http.ResponseWriter, r *http.Request) {
+	responses := []response{{
+		Href:     s.homePath(),
+		Propstat: propstat{Prop: prop{ResourceType: &resourceType{Collection: &struct{}{}}}},
+	}}
+	if r.Header.Get("Depth") != "0" {
+		for _, cal := range s.calendars {
+			responses = append(responses, s.calendarResponse(cal))
+		}
+	}
+	s.writeMultistatus(w, responses)
+}
+
+func (s *Server) calendarResponse(cal *fakeCalendar) response {
+	return response{
+		Href: s.homePath() + cal.name + "/",
+		Propstat: propstat{Prop: prop{
+			ResourceType:     &resourceType{Collection: &struct{}{}, Calendar: &struct{}{}},
+			DisplayName:      cal.displayName,
+			ComponentSet:     &componentSet{Comps: []comp{{Name: "VEVENT"}}},
+			CalendarTimezone: utcTimezone,
+		}},
+	}
+}
+
+// calendarQuery is the part of a calendar-query REPORT the fake honors.
+type calendarQuery struct {
+	TimeRange *struct {
+		Start string `xml:"start,attr"`
+		End   string `xml:"end,attr"`
+	} `xml:"filter>comp-filter>comp-filter>time-range"`
+}
+
+func (s *Server) report(w http.ResponseWriter, r *http.Request, cal *fakeCalendar) {
+	var query calendarQuery
+	if err := xml.NewDecoder(r.Body).Decode(&query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var start, end time.Time
+	if query.TimeRange != nil {
+		start, _ = parseTime(query.TimeRange.Start)
+		end, _ = parseTime(query.TimeRange.End)
+	}
+
+	names := make([]string, 0, len(cal.objects))
+	for name := range cal.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var responses []response
+	for _, name := range names {
+		obj := cal.objects[name]
+		if !overlaps(obj.data, start, end) {
+			continue
+		}
+		responses = append(responses, response{
+			Href:     s.homePath() + cal.name + "/" + name,
+			Propstat: propstat{Prop: prop{ETag: obj.etag, CalendarData: obj.data}},
+		})
+	}
+	s.writeMultistatus(w, responses)
+}
+
+func (s *Server) serveObject(w http.ResponseWriter, r *http.Request, cal *fakeCalendar, name string) {
+	existing := cal.objects[name]
+	if match := r.Header.Get("If-Match"); match != "" && (existing == nil || (match != "*" && match != existing.etag)) {
+		http.Error(w, "precondition failed", http.StatusPreconditionFailed)
+		return
+	}
+	if r.Header.Get("If-None-Match") == "*" && existing != nil {
+		http.Error(w, "precondition failed", http.StatusPreconditionFailed)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if existing == nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("ETag", existing.etag)
+		io.WriteString(w, existing.data)
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !strings.Contains(string(body), "BEGIN:VCALENDAR") {
+			http.Error(w, "not iCalendar data", http.StatusUnsupportedMediaType)
+			return
+		}
+		obj := newObject(string(body))
+		cal.objects[name] = obj
+		w.Header().Set("ETag", obj.etag)
+		if existing == nil {
+			w.WriteHeader(http.StatusCreated)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case http.MethodDelete:
+		if existing == nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		delete(cal.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// newObject stores data under an ETag derived from it.
+func newObject(data string) *object {
+	sum := sha256.Sum256([]byte(data))
+	return &object{data: data, etag: `"` + hex.EncodeToString(sum[:8]) + `"`}
+}
+
+// calendar returns the calendar called name, or nil. s.mu must be held.
+func (s *Server) calendar(name string) *fakeCalendar {
+	for _, cal := range s.calendars {
+		if cal.name == name {
+			return cal
+		}
+	}
+	return nil
+}
+
+// overlaps reports whether the event in data may fall between start and end,
+// either of which may be zero.
+func overlaps(data string, start, end time.Time) bool {
+	var dtstart, dtend time.Time
+	var recurring bool
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, "\r")
+		name, _, _ := strings.Cut(line, ":")
+		value := line[strings.LastIndexByte(line, ':')+1:]
+		switch strings.SplitN(name, ";", 2)[0] {
+		case "DTSTART":
+			dtstart, _ = parseTime(value)
+		case "DTEND":
+			dtend, _ = parseTime(value)
+		case "RRULE", "RDATE":
+			recurring = true
+		}
+	}
+	if dtend.IsZero() {
+		dtend = dtstart
+	}
+	if !start.IsZero() && !recurring && !dtend.IsZero() && !dtend.After(start) {
+		return false
+	}
+	if !end.IsZero() && !dtstart.IsZero() && !dtstart.Before(end) {
+		return false
+	}
+	return true
+}
+
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
+
+type multistatus struct {
+	XMLName   xml.Name   `xml:"DAV: multistatus"`
+	Responses []response `xml:"DAV: response"`
+}
+
+type response struct {
+	Href     string   `xml:"DAV: href"`
+	Propstat propstat `xml:"DAV: propstat"`
+}
+
+// propstat always succeeds: every property the fake reports exists.
+type propstat struct {
+	Prop   prop   `xml:"DAV: prop"`
+	Status string `xml:"DAV: status"`
+}
+
+type prop struct {
+	CurrentUserPrincipal *href         `xml:"DAV: current-user-principal,omitempty"`
+	CalendarHomeSet      *href         `xml:"urn:ietf:params:xml:ns:caldav calendar-home-set,omitempty"`
+	ResourceType         *resourceType `xml:"DAV: resourcetype,omitempty"`
+	DisplayName          string        `xml:"DAV: displayname,omitempty"`
+	ComponentSet         *componentSet `xml:"urn:ietf:params:xml:ns:caldav supported-calendar-component-set,omitempty"`
+	CalendarTimezone     string        `xml:"urn:ietf:params:xml:ns:caldav calendar-timezone,omitempty"`
+	ETag                 string        `xml:"DAV: getetag,omitempty"`
+	CalendarData         string        `xml:"urn:ietf:params:xml:ns:caldav calendar-data,omitempty"`
+}
+
+type href struct {
+	Href string `xml:"DAV: href"`
+}
+
+type resourceType struct {
+	Collection *struct{} `xml:"DAV: collection,omitempty"`
+	Calendar   *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar,omitempty"`
+}
+
+type componentSet struct {
+	Comps []comp `xml:"urn:ietf:params:xml:ns:caldav comp"`
+}
+
+type comp struct {
+	Name string `xml:"name,attr"`
+}
+
+func (s *Server) writeMultistatus(w http.ResponseWriter, responses []response) {
+	for i := range responses {
+		responses[i].Propstat.Status = "HTTP/1.1 200 OK"
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(multistatus{Responses: responses})
+}
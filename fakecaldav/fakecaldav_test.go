@@ -0,0 +1,69 @@
+package fakecaldav
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testEvent = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VEVENT\r\nUID:review\r\nDTSTART:20250602T100000Z\r\nDTEND:20250602T110000Z\r\nSUMMARY:Review\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+func request(t *testing.T, s *Server, method, path, body string, header map[string]string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, s.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth(s.Username, s.Password)
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestETagPreconditions(t *testing.T) {
+	s := New("alice", "secret")
+	defer s.Close()
+	object := "/dav/calendars/alice/personal/review.ics"
+
+	created := request(t, s, http.MethodPut, object, testEvent, map[string]string{"If-None-Match": "*"})
+	if created.StatusCode != http.StatusCreated || created.Header.Get("ETag") == "" {
+		t.Fatalf("expected the event to be created with an ETag, got %s", created.Status)
+	}
+	if resp := request(t, s, http.MethodPut, object, testEvent, map[string]string{"If-None-Match": "*"}); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("expected creating it again to fail, got %s", resp.Status)
+	}
+	if resp := request(t, s, http.MethodDelete, object, "", map[string]string{"If-Match": `"stale"`}); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("expected deleting with a stale ETag to fail, got %s", resp.Status)
+	}
+	if resp := request(t, s, http.MethodDelete, object, "", map[string]string{"If-Match": created.Header.Get("ETag")}); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected deleting with the current ETag to succeed, got %s", resp.Status)
+	}
+	if len(s.Objects("personal")) != 0 {
+		t.Fatal("expected the event to be gone")
+	}
+}
+
+func TestRequiresCredentials(t *testing.T) {
+	s := New("alice", "secret")
+	defer s.Close()
+
+	req, err := http.NewRequest("PROPFIND", s.URL+"/dav/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("alice", "wrong")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong password to be rejected, got %s", resp.Status)
+	}
+}
@@ -0,0 +1,707 @@
+// Package fakegoogle is an in-process stand-in for Google's OAuth 2.0
+// provider and the Calendar REST API, so the server can be exercised in tests
+// and local demos without real Google credentials.
+//
+// Consent is granted automatically: the authorization endpoint redirects
+// straight back with a code for the user named by login_hint, or the first
+// user, and device codes are approved on the first poll unless
+// SetDevicePendingPolls says otherwise. PKCE, refresh tokens, revocation and
+// scope checks on the Calendar API behave like Google's, closely enough for
+// the server's purposes.
+package fakegoogle
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/calendar/v3"
+)
+
+const (
+	scopeCalendar       = "https://www.googleapis.com/auth/calendar"
+	scopeCalendarEvents = "https://www.googleapis.com/auth/calendar.events"
+
+	tokenLifetime = time.Hour
+)
+
+// User is a Google account known to the fake provider.
+type User struct {
+	Sub   string
+	Email string
+	Name  string
+}
+
+// DefaultUser is the only user of a Server started without any.
+var DefaultUser = User{Sub: "fake-user", Email: "user@example.com", Name: "Fake User"}
+
+// Server is a running fake provider. Point the OAuth endpoint, userinfo,
+// revoke, tokeninfo and Calendar API URLs of the server under test at it.
+type Server struct {
+	URL string
+
+	srv *httptest.Server
+
+	mu            sync.Mutex
+	users         []*User
+	denyConsent   bool
+	pendingPolls  int               // authorization_pending answers before approving a device code
+	codes         map[string]*grant // by authorization code
+	deviceCodes   map[string]*grant // by device code
+	accessTokens  map[string]*grant
+	refreshTokens map[string]*grant
+	calendars     map[string][]*fakeCalendar // by user sub
+	nextID        int
+}
+
+// grant is what the user consented to, and to whom.
+type grant struct {
+	user      *User
+	clientID  string
+	scopes    []string
+	challenge string // PKCE S256 challenge of an authorization code
+	expires   time.Time
+	pending   int // polls of a device code left to answer authorization_pending
+}
+
+type fakeCalendar struct {
+	id      string
+	summary string
+	primary bool
+	events  []*calendar.Event
+}
+
+// New starts a fake provider knowing users, or DefaultUser if there are
+// none. Every user has a primary calendar whose ID is their email address.
+// Call Close when done.
+func New(users ...User) *Server {
+	if len(users) == 0 {
+		users = []User{DefaultUser}
+	}
+	s := &Server{
+		codes:         make(map[string]*grant),
+		deviceCodes:   make(map[string]*grant),
+		accessTokens:  make(map[string]*grant),
+		refreshTokens: make(map[string]*grant),
+		calendars:     make(map[string][]*fakeCalendar),
+	}
+	for _, user := range users {
+		s.users = append(s.users, &user)
+		s.calendars[user.Sub] = []*fakeCalendar{{id: user.Email, summary: user.Email, primary: true}}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /o/oauth2/auth", s.handleAuthorize)
+	mux.HandleFunc("POST /token", s.handleToken)
+	mux.HandleFunc("POST /device/code", s.handleDeviceCode)
+	mux.HandleFunc("GET /v1/userinfo", s.handleUserInfo)
+	mux.HandleFunc("POST /revoke", s.handleRevoke)
+	mux.HandleFunc("GET /tokeninfo", s.handleTokenInfo)
+	mux.HandleFunc("GET /calendar/v3/users/me/calendarList", s.handleCalendarList)
+	mux.HandleFunc("GET /calendar/v3/calendars/{calendarId}/events", s.handleListEvents)
+	mux.HandleFunc("POST /calendar/v3/calendars/{calendarId}/events", s.handleInsertEvent)
+	mux.HandleFunc("GET /calendar/v3/calendars/{calendarId}/events/{eventId}", s.handleGetEvent)
+	mux.HandleFunc("DELETE /calendar/v3/calendars/{calendarId}/events/{eventId}", s.handleDeleteEvent)
+	mux.HandleFunc("POST /calendar/v3/freeBusy", s.handleFreeBusy)
+	mux.HandleFunc("GET /calendar/v3/users/me/settings", s.handleSettings)
+	s.srv = httptest.NewServer(mux)
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts the provider down.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Endpoint is the OAuth 2.0 endpoint to use instead of google.Endpoint.
+func (s *Server) Endpoint() oauth2.Endpoint {
+	return oauth2.Endpoint{
+		AuthURL:       s.URL + "/o/oauth2/auth",
+		TokenURL:      s.URL + "/token",
+		DeviceAuthURL: s.URL + "/device/code",
+		AuthStyle:     oauth2.AuthStyleInParams,
+	}
+}
+
+// UserInfoURL is the OpenID Connect userinfo endpoint.
+func (s *Server) UserInfoURL() string { return s.URL + "/v1/userinfo" }
+
+// RevokeURL is the token revocation endpoint.
+func (s *Server) RevokeURL() string { return s.URL + "/revoke" }
+
+// TokenInfoURL is the access token introspection endpoint.
+func (s *Server) TokenInfoURL() string { return s.URL + "/tokeninfo" }
+
+// CalendarURL is the Calendar API base path, for option.WithEndpoint.
+func (s *Server) CalendarURL() string { return s.URL + "/calendar/v3/" }
+
+// SetDenyConsent makes the authorization endpoint, and polls for device
+// codes, answer as if the user declined, with error=access_denied.
+func (s *Server) SetDenyConsent(deny bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.denyConsent = deny
+}
+
+// SetDevicePendingPolls makes device codes issued from now on answer polls
+// with authorization_pending n times before they are approved, as if the
+// user took a while.
+func (s *Server) SetDevicePendingPolls(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pendingPolls = n
+}
+
+// ExpireDeviceCodes makes every device code issued so far expire, as if the
+// user never entered it.
+func (s *Server) ExpireDeviceCodes() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, g := range s.deviceCodes {
+		g.expires = time.Now()
+	}
+}
+
+// AddCalendar gives the user with the given email another calendar.
+func (s *Server) AddCalendar(email, id, summary string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.userByEmail(email)
+	if user == nil {
+		panic("fakegoogle: unknown user " + email)
+	}
+	s.calendars[user.Sub] = append(s.calendars[user.Sub], &fakeCalendar{id: id, summary: summary})
+}
+
+// AddEvent stores event in a calendar of the user with the given email, as
+// if created in Google Calendar, and returns it with its ID set.
+func (s *Server) AddEvent(email, calendarID string, event *calendar.Event) *calendar.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.userByEmail(email)
+	if user == nil {
+		panic("fakegoogle: unknown user " + email)
+	}
+	cal := s.calendar(user, calendarID)
+	if cal == nil {
+		panic("fakegoogle: unknown calendar " + calendarID)
+	}
+	return s.insertEvent(cal, event)
+}
+
+// Events returns the events of a calendar of the user with the given email.
+func (s *Server) Events(email, calendarID string) []*calendar.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.userByEmail(email)
+	if user == nil {
+		return nil
+	}
+	if cal := s.calendar(user, calendarID); cal != nil {
+		return slices.Clone(cal.events)
+	}
+	return nil
+}
+
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || query.Get("redirect_uri") == "" || query.Get("response_type") != "code" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	if query.Get("code_challenge") != "" && query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "unsupported code_challenge_method", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	params := url.Values{"state": {query.Get("state")}}
+	if s.denyConsent {
+		params.Set("error", "access_denied")
+	} else {
+		user := s.userByEmail(query.Get("login_hint"))
+		if user == nil {
+			user = s.users[0]
+		}
+		code := s.newSecret()
+		s.codes[code] = &grant{
+			user:      user,
+			clientID:  query.Get("client_id"),
+			scopes:    s.grantedScopes(user, query.Get("scope"), query.Get("include_granted_scopes") == "true"),
+			challenge: query.Get("code_challenge"),
+			expires:   time.Now().Add(10 * time.Minute),
+		}
+		params.Set("code", code)
+		params.Set("scope", strings.Join(s.codes[code].scopes, " "))
+	}
+	s.mu.Unlock()
+
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var g *grant
+	issueRefreshToken := true
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code := r.PostForm.Get("code")
+		g = s.codes[code]
+		delete(s.codes, code)
+		if g == nil || time.Now().After(g.expires) {
+			tokenError(w, "invalid_grant")
+			return
+		}
+		if g.challenge != "" {
+			sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+			if base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+				tokenError(w, "invalid_grant")
+				return
+			}
+		}
+	case "refresh_token":
+		g = s.refreshTokens[r.PostForm.Get("refresh_token")]
+		if g == nil {
+			tokenError(w, "invalid_grant")
+			return
+		}
+		issueRefreshToken = false
+	case "urn:ietf:params:oauth:grant-type:device_code":
+		deviceCode := r.PostForm.Get("device_code")
+		g = s.deviceCodes[deviceCode]
+		if g == nil || !time.Now().Before(g.expires) {
+			delete(s.deviceCodes, deviceCode)
+			tokenError(w, "expired_token")
+			return
+		}
+		if g.pending > 0 {
+			g.pending--
+			tokenError(w, "authorization_pending")
+			return
+		}
+		delete(s.deviceCodes, deviceCode)
+		if s.denyConsent {
+			tokenError(w, "access_denied")
+			return
+		}
+	default:
+		tokenError(w, "unsupported_grant_type")
+		return
+	}
+
+	accessToken := s.newSecret()
+	s.accessTokens[accessToken] = &grant{user: g.user, clientID: g.clientID, scopes: g.scopes, expires: time.Now().Add(tokenLifetime)}
+	resp := map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(tokenLifetime.Seconds()),
+		"scope":        strings.Join(g.scopes, " "),
+	}
+	if issueRefreshToken {
+		refreshToken := s.newSecret()
+		s.refreshTokens[refreshToken] = &grant{user: g.user, clientID: g.clientID, scopes: g.scopes}
+		resp["refresh_token"] = refreshToken
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleDeviceCode(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.users[0]
+	deviceCode := s.newSecret()
+	s.deviceCodes[deviceCode] = &grant{
+		user:     user,
+		clientID: r.PostForm.Get("client_id"),
+		scopes:   s.grantedScopes(user, r.PostForm.Get("scope"), true),
+		expires:  time.Now().Add(10 * time.Minute),
+		pending:  s.pendingPolls,
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"device_code":      deviceCode,
+		"user_code":        "FAKE-CODE",
+		"verification_url": s.URL + "/device",
+		"expires_in":       600,
+		"interval":         1,
+	})
+}
+
+func (s *Server) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	g := s.authorize(w, r, "")
+	if g == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"sub":   g.user.Sub,
+		"email": g.user.Email,
+		"name":  g.user.Name,
+	})
+}
+
+func (s *Server) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+	token := r.PostForm.Get("token")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if g, ok := s.refreshTokens[token]; ok {
+		// Revoking a refresh token also revokes its access tokens
+		delete(s.refreshTokens, token)
+		for accessToken, access := range s.accessTokens {
+			if access.user == g.user && access.clientID == g.clientID {
+				delete(s.accessTokens, accessToken)
+			}
+		}
+	} else if _, ok := s.accessTokens[token]; ok {
+		delete(s.accessTokens, token)
+	} else {
+		tokenError(w, "invalid_token")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleTokenInfo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	g, ok := s.accessTokens[r.URL.Query().Get("access_token")]
+	s.mu.Unlock()
+	if !ok || time.Now().After(g.expires) {
+		tokenError(w, "invalid_token")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"aud":        g.clientID,
+		"azp":        g.clientID,
+		"sub":        g.user.Sub,
+		"email":      g.user.Email,
+		"scope":      strings.Join(g.scopes, " "),
+		"expires_in": strconv.Itoa(int(time.Until(g.expires).Seconds())),
+	})
+}
+
+func (s *Server) handleCalendarList(w http.ResponseWriter, r *http.Request) {
+	g := s.authorize(w, r, "")
+	if g == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := &calendar.CalendarList{Kind: "calendar#calendarList"}
+	for _, cal := range s.calendars[g.user.Sub] {
+		list.Items = append(list.Items, &calendar.CalendarListEntry{
+			Kind:    "calendar#calendarListEntry",
+			Id:      cal.id,
+			Summary: cal.summary,
+			Primary: cal.primary,
+		})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleListEvents(w http.ResponseWriter, r *http.Request) {
+	g := s.authorize(w, r, "")
+	if g == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cal := s.calendar(g.user, r.PathValue("calendarId"))
+	if cal == nil {
+		apiError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	query := r.URL.Query()
+	timeMin, _ := time.Parse(time.RFC3339, query.Get("timeMin"))
+	timeMax, _ := time.Parse(time.RFC3339, query.Get("timeMax"))
+	items := eventsBetween(cal, timeMin, timeMax)
+	if limit, err := strconv.Atoi(query.Get("maxResults")); err == nil && limit < len(items) {
+		items = items[:limit]
+	}
+	writeJSON(w, http.StatusOK, &calendar.Events{Kind: "calendar#events", Summary: cal.summary, Items: items})
+}
+
+func (s *Server) handleInsertEvent(w http.ResponseWriter, r *http.Request) {
+	g := s.authorize(w, r, scopeCalendarEvents)
+	if g == nil {
+		return
+	}
+	var event calendar.Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		apiError(w, http.StatusBadRequest, "Invalid event")
+		return
+	}
+	if event.Start == nil || event.End == nil {
+		apiError(w, http.StatusBadRequest, "Missing start or end time")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cal := s.calendar(g.user, r.PathValue("calendarId"))
+	if cal == nil {
+		apiError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.insertEvent(cal, &event))
+}
+
+func (s *Server) handleGetEvent(w http.ResponseWriter, r *http.Request) {
+	g := s.authorize(w, r, "")
+	if g == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cal := s.calendar(g.user, r.PathValue("calendarId"))
+	if cal == nil {
+		apiError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	for _, event := range cal.events {
+		if event.Id == r.PathValue("eventId") {
+			writeJSON(w, http.StatusOK, event)
+			return
+		}
+	}
+	apiError(w, http.StatusNotFound, "Not Found")
+}
+
+func (s *Server) handleDeleteEvent(w http.ResponseWriter, r *http.Request) {
+	g := s.authorize(w, r, scopeCalendarEvents)
+	if g == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cal := s.calendar(g.user, r.PathValue("calendarId"))
+	if cal == nil {
+		apiError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	for i, event := range cal.events {
+		if event.Id == r.PathValue("eventId") {
+			cal.events = slices.Delete(cal.events, i, i+1)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	apiError(w, http.StatusNotFound, "Not Found")
+}
+
+func (s *Server) handleFreeBusy(w http.ResponseWriter, r *http.Request) {
+	g := s.authorize(w, r, "")
+	if g == nil {
+		return
+	}
+	var request calendar.FreeBusyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apiError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	timeMin, err := time.Parse(time.RFC3339, request.TimeMin)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "Invalid timeMin")
+		return
+	}
+	timeMax, err := time.Parse(time.RFC3339, request.TimeMax)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "Invalid timeMax")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := &calendar.FreeBusyResponse{
+		Kind:      "calendar#freeBusy",
+		TimeMin:   request.TimeMin,
+		TimeMax:   request.TimeMax,
+		Calendars: make(map[string]calendar.FreeBusyCalendar),
+	}
+	for _, item := range request.Items {
+		cal := s.calendar(g.user, item.Id)
+		if cal == nil {
+			resp.Calendars[item.Id] = calendar.FreeBusyCalendar{Errors: []*calendar.Error{{Domain: "global", Reason: "notFound"}}}
+			continue
+		}
+		busy := []*calendar.TimePeriod{}
+		for _, event := range eventsBetween(cal, timeMin, timeMax) {
+			busy = append(busy, &calendar.TimePeriod{
+				Start: eventStart(event).Format(time.RFC3339),
+				End:   eventEnd(event).Format(time.RFC3339),
+			})
+		}
+		resp.Calendars[item.Id] = calendar.FreeBusyCalendar{Busy: busy}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
+	if g := s.authorize(w, r, ""); g == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, &calendar.Settings{
+		Kind: "calendar#settings",
+		Items: []*calendar.Setting{
+			{Kind: "calendar#setting", Id: "timezone", Value: "UTC"},
+			{Kind: "calendar#setting", Id: "locale", Value: "en"},
+			{Kind: "calendar#setting", Id: "weekStart", Value: "1"},
+		},
+	})
+}
+
+// authorize returns the grant behind the bearer token of r, which must hold
+// scope unless it is empty. Otherwise it answers the request and returns nil.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, scope string) *grant {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	g, ok := s.accessTokens[token]
+	s.mu.Unlock()
+	if !ok || time.Now().After(g.expires) {
+		apiError(w, http.StatusUnauthorized, "Invalid Credentials")
+		return nil
+	}
+	if scope != "" && !slices.Contains(g.scopes, scope) && !slices.Contains(g.scopes, scopeCalendar) {
+		apiError(w, http.StatusForbidden, "Request had insufficient authentication scopes.")
+		return nil
+	}
+	return g
+}
+
+// grantedScopes returns requested, plus what user already granted when
+// includeGranted is set. s.mu must be held.
+func (s *Server) grantedScopes(user *User, requested string, includeGranted bool) []string {
+	scopes := strings.Fields(requested)
+	if includeGranted {
+		for _, g := range s.refreshTokens {
+			if g.user == user {
+				scopes = append(scopes, g.scopes...)
+			}
+		}
+	}
+	slices.Sort(scopes)
+	return slices.Compact(scopes)
+}
+
+// userByEmail returns the user with email, or nil. s.mu must be held.
+func (s *Server) userByEmail(email string) *User {
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, email) {
+			return user
+		}
+	}
+	return nil
+}
+
+// calendar returns the calendar of user with id, which may be "primary", or
+// nil. s.mu must be held.
+func (s *Server) calendar(user *User, id string) *fakeCalendar {
+	for _, cal := range s.calendars[user.Sub] {
+		if cal.id == id || (id == "primary" && cal.primary) {
+			return cal
+		}
+	}
+	return nil
+}
+
+// insertEvent adds event to cal. s.mu must be held.
+func (s *Server) insertEvent(cal *fakeCalendar, event *calendar.Event) *calendar.Event {
+	s.nextID++
+	event.Id = fmt.Sprintf("event%d", s.nextID)
+	event.Kind = "calendar#event"
+	event.Status = "confirmed"
+	event.HtmlLink = s.URL + "/calendar/event?eid=" + event.Id
+	cal.events = append(cal.events, event)
+	return event
+}
+
+// newSecret returns a random token. s.mu must be held.
+func (s *Server) newSecret() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// eventsBetween returns the events of cal overlapping timeMin to timeMax,
+// ordered by start. Zero bounds do not restrict anything. s.mu must be held.
+func eventsBetween(cal *fakeCalendar, timeMin, timeMax time.Time) []*calendar.Event {
+	var items []*calendar.Event
+	for _, event := range cal.events {
+		if (!timeMin.IsZero() && !eventEnd(event).After(timeMin)) || (!timeMax.IsZero() && !eventStart(event).Before(timeMax)) {
+			continue
+		}
+		items = append(items, event)
+	}
+	sort.SliceStable(items, func(i, j int) bool { return eventStart(items[i]).Before(eventStart(items[j])) })
+	return items
+}
+
+// eventStart returns when event starts. All-day events start at midnight UTC.
+func eventStart(event *calendar.Event) time.Time {
+	return parseEventTime(event.Start)
+}
+
+// eventEnd returns when event ends.
+func eventEnd(event *calendar.Event) time.Time {
+	return parseEventTime(event.End)
+}
+
+func parseEventTime(t *calendar.EventDateTime) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	if parsed, err := time.Parse(time.RFC3339, t.DateTime); err == nil {
+		return parsed
+	}
+	parsed, _ := time.Parse(time.DateOnly, t.Date)
+	return parsed
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// tokenError answers an OAuth endpoint request with an RFC 6749 error.
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+// apiError answers a Calendar API request with a Google API error.
+func apiError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{
+		"error": map[string]any{"code": status, "message": message},
+	})
+}
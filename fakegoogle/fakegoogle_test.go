@@ -0,0 +1,107 @@
+package fakegoogle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// authorize runs the authorization code flow with PKCE against s.
+func authorize(t *testing.T, s *Server, scopes ...string) (*oauth2.Config, *oauth2.Token) {
+	t.Helper()
+	var code string
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code = r.URL.Query().Get("code")
+	}))
+	defer callback.Close()
+
+	config := &oauth2.Config{ClientID: "client", RedirectURL: callback.URL, Scopes: scopes, Endpoint: s.Endpoint()}
+	verifier := oauth2.GenerateVerifier()
+	resp, err := http.Get(config.AuthCodeURL("state", oauth2.S256ChallengeOption(verifier)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if code == "" {
+		t.Fatal("expected a code on the redirect")
+	}
+
+	if _, err := config.Exchange(context.Background(), code, oauth2.VerifierOption("wrong")); err == nil {
+		t.Fatal("expected a wrong PKCE verifier to be rejected")
+	}
+	// The failed exchange consumed the code, so get another one
+	resp, err = http.Get(config.AuthCodeURL("state", oauth2.S256ChallengeOption(verifier)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	token, err := config.Exchange(context.Background(), code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config, token
+}
+
+func TestCalendarRequiresGrantedScopes(t *testing.T) {
+	s := New()
+	defer s.Close()
+	s.AddEvent(DefaultUser.Email, "primary", &calendar.Event{
+		Summary: "Standup",
+		Start:   &calendar.EventDateTime{DateTime: "2025-06-02T09:00:00Z"},
+		End:     &calendar.EventDateTime{DateTime: "2025-06-02T09:15:00Z"},
+	})
+
+	config, token := authorize(t, s, "https://www.googleapis.com/auth/calendar.readonly")
+	srv, err := calendar.NewService(context.Background(),
+		option.WithTokenSource(config.TokenSource(context.Background(), token)),
+		option.WithEndpoint(s.CalendarURL()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := srv.Events.List("primary").Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) != 1 || events.Items[0].Summary != "Standup" {
+		t.Fatalf("unexpected events: %+v", events.Items)
+	}
+
+	_, err = srv.Events.Insert("primary", &calendar.Event{
+		Start: &calendar.EventDateTime{DateTime: "2025-06-02T10:00:00Z"},
+		End:   &calendar.EventDateTime{DateTime: "2025-06-02T11:00:00Z"},
+	}).Do()
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusForbidden {
+		t.Fatalf("expected a read-only token to be refused, got %v", err)
+	}
+}
+
+func TestDeniedConsent(t *testing.T) {
+	s := New()
+	defer s.Close()
+	s.SetDenyConsent(true)
+
+	var errorCode string
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errorCode = r.URL.Query().Get("error")
+	}))
+	defer callback.Close()
+
+	config := &oauth2.Config{ClientID: "client", RedirectURL: callback.URL, Endpoint: s.Endpoint()}
+	resp, err := http.Get(config.AuthCodeURL("state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if errorCode != "access_denied" {
+		t.Fatalf("expected access_denied, got %q", errorCode)
+	}
+}
@@ -6,8 +6,10 @@ toolchain go1.24.2
 
 require (
 	github.com/mark3labs/mcp-go v0.29.0
+	github.com/teambition/rrule-go v1.8.2
 	golang.org/x/oauth2 v0.30.0
 	google.golang.org/api v0.234.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
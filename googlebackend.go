@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// googleBackend is the CalendarBackend of Google Calendar.
+type googleBackend struct {
+	srv *calendar.Service
+}
+
+func newGoogleBackend(srv *calendar.Service) *googleBackend {
+	return &googleBackend{srv: srv}
+}
+
+func (b *googleBackend) ListCalendars(ctx context.Context) ([]*Calendar, error) {
+	list, err := b.srv.CalendarList.List().Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	calendars := make([]*Calendar, 0, len(list.Items))
+	for _, item := range list.Items {
+		calendars = append(calendars, &Calendar{
+			ID:       item.Id,
+			Summary:  item.Summary,
+			Primary:  item.Primary,
+			TimeZone: item.TimeZone,
+		})
+	}
+	return calendars, nil
+}
+
+func (b *googleBackend) ListEvents(ctx context.Context, calendarID string, query EventQuery) ([]*Event, error) {
+	call := b.srv.Events.List(calendarID).
+		SingleEvents(true).
+		OrderBy("startTime").
+		Context(ctx)
+	if query.MaxResults > 0 {
+		call = call.MaxResults(query.MaxResults)
+	}
+	if !query.TimeMin.IsZero() {
+		call = call.TimeMin(query.TimeMin.Format(time.RFC3339))
+	}
+	if !query.TimeMax.IsZero() {
+		call = call.TimeMax(query.TimeMax.Format(time.RFC3339))
+	}
+
+	events, err := call.Do()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*Event, 0, len(events.Items))
+	for _, item := range events.Items {
+		items = append(items, fromGoogleEvent(item))
+	}
+	return items, nil
+}
+
+func (b *googleBackend) GetEvent(ctx context.Context, calendarID, eventID string) (*Event, error) {
+	event, err := b.srv.Events.Get(calendarID, eventID).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	return fromGoogleEvent(event), nil
+}
+
+func (b *googleBackend) CreateEvent(ctx context.Context, calendarID string, event *Event) (*Event, error) {
+	created, err := b.srv.Events.Insert(calendarID, toGoogleEvent(event)).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	return fromGoogleEvent(created), nil
+}
+
+func (b *googleBackend) DeleteEvent(ctx context.Context, calendarID, eventID string) error {
+	return b.srv.Events.Delete(calendarID, eventID).Context(ctx).Do()
+}
+
+func (b *googleBackend) FreeBusy(ctx context.Context, calendarIDs []string, timeMin, timeMax time.Time) (map[string][]TimeRange, error) {
+	request := &calendar.FreeBusyRequest{
+		TimeMin: timeMin.Format(time.RFC3339),
+		TimeMax: timeMax.Format(time.RFC3339),
+	}
+	for _, id := range calendarIDs {
+		request.Items = append(request.Items, &calendar.FreeBusyRequestItem{Id: id})
+	}
+	resp, err := b.srv.Freebusy.Query(request).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	busy := make(map[string][]TimeRange, len(resp.Calendars))
+	for id, cal := range resp.Calendars {
+		if len(cal.Errors) > 0 {
+			return nil, fmt.Errorf("free/busy of %s unavailable: %s", id, cal.Errors[0].Reason)
+		}
+		ranges := make([]TimeRange, 0, len(cal.Busy))
+		for _, period := range cal.Busy {
+			start, err := time.Parse(time.RFC3339, period.Start)
+			if err != nil {
+				return nil, err
+			}
+			end, err := time.Parse(time.RFC3339, period.End)
+			if err != nil {
+				return nil, err
+			}
+			ranges = append(ranges, TimeRange{Start: start, End: end})
+		}
+		busy[id] = ranges
+	}
+	return busy, nil
+}
+
+func (b *googleBackend) Settings(ctx context.Context) (*CalendarSettings, error) {
+	list, err := b.srv.Settings.List().Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	settings := &CalendarSettings{}
+	for _, item := range list.Items {
+		switch item.Id {
+		case "timezone":
+			settings.TimeZone = item.Value
+		case "locale":
+			settings.Locale = item.Value
+		case "weekStart":
+			// "0" for Sunday, "1" for Monday, "6" for Saturday
+			if day, err := strconv.Atoi(item.Value); err == nil {
+				settings.WeekStart = time.Weekday(day)
+			}
+		}
+	}
+	return settings, nil
+}
+
+func fromGoogleEvent(event *calendar.Event) *Event {
+	return &Event{
+		ID:          event.Id,
+		Summary:     event.Summary,
+		Description: event.Description,
+		Location:    event.Location,
+		Start:       fromGoogleEventTime(event.Start),
+		End:         fromGoogleEventTime(event.End),
+		Status:      event.Status,
+		HTMLLink:    event.HtmlLink,
+	}
+}
+
+func fromGoogleEventTime(t *calendar.EventDateTime) EventTime {
+	if t == nil {
+		return EventTime{}
+	}
+	if t.DateTime == "" {
+		date, _ := time.Parse(time.DateOnly, t.Date)
+		return EventTime{Time: date, AllDay: true}
+	}
+	dateTime, _ := time.Parse(time.RFC3339, t.DateTime)
+	return EventTime{Time: dateTime}
+}
+
+func toGoogleEvent(event *Event) *calendar.Event {
+	return &calendar.Event{
+		Summary:     event.Summary,
+		Description: event.Description,
+		Location:    event.Location,
+		Start:       toGoogleEventTime(event.Start),
+		End:         toGoogleEventTime(event.End),
+	}
+}
+
+func toGoogleEventTime(t EventTime) *calendar.EventDateTime {
+	if t.AllDay {
+		return &calendar.EventDateTime{Date: t.String()}
+	}
+	return &calendar.EventDateTime{DateTime: t.String()}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// The name and version the MCP server reports to clients, and /version to
+// everyone else.
+const (
+	serverName    = "Google Calendar MCP"
+	serverVersion = "0.1.0"
+)
+
+// readyCheckCalendarAPI makes /readyz also check that the Calendar API can
+// be reached.
+var readyCheckCalendarAPI = false
+
+// readyCheckTimeout bounds each readiness check.
+const readyCheckTimeout = 5 * time.Second
+
+// healthStatus is the body of the health endpoints.
+type healthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// handleHealthz reports that the process serves HTTP at all.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, healthStatus{Status: "ok"})
+}
+
+// handleReadyz reports whether the server can take sessions: it is not
+// shutting down, it can authorize users, and, with readyCheckCalendarAPI,
+// the Calendar API answers.
+func (h *mcpHandler) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := make(map[string]string)
+	ready := true
+	check := func(name string, err error) {
+		if err != nil {
+			checks[name] = err.Error()
+			ready = false
+		} else {
+			checks[name] = "ok"
+		}
+	}
+
+	if h.draining.Load() {
+		check("shutdown", errShuttingDown)
+	}
+	check("oauth", checkOAuthConfig())
+	if readyCheckCalendarAPI && usesCalendarAPI() {
+		ctx, cancel := context.WithTimeout(r.Context(), readyCheckTimeout)
+		defer cancel()
+		check("calendar_api", checkCalendarAPI(ctx))
+	}
+
+	if !ready {
+		writeHealth(w, http.StatusServiceUnavailable, healthStatus{Status: "not ready", Checks: checks})
+		return
+	}
+	writeHealth(w, http.StatusOK, healthStatus{Status: "ready", Checks: checks})
+}
+
+// handleVersion reports what the server tells MCP clients it is.
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"name": serverName, "version": serverVersion})
+}
+
+// checkOAuthConfig fails unless users can authorize, which a configured
+// account makes unnecessary.
+func checkOAuthConfig() error {
+	if accounts.fallbackAccount() != nil {
+		return nil
+	}
+	switch {
+	case oauthConfig == nil:
+		return fmt.Errorf("OAuth is not configured")
+	case oauthConfig.ClientID == "":
+		return fmt.Errorf("GOOGLE_CLIENT_ID is not set")
+	case oauthConfig.Endpoint.AuthURL == "" || oauthConfig.Endpoint.TokenURL == "":
+		return fmt.Errorf("the OAuth endpoints are not set")
+	}
+	return nil
+}
+
+// usesCalendarAPI reports whether the tools go to Google rather than to a
+// CalDAV server or local files.
+func usesCalendarAPI() bool {
+	acct := accounts.fallbackAccount()
+	return acct == nil || !(acct.CalDAV || acct.Local)
+}
+
+// checkCalendarAPI fails unless the Calendar API answers over HTTP. Any
+// status will do, since the request is not authorized.
+func checkCalendarAPI(ctx context.Context) error {
+	url := cmp.Or(calendarAPIURL, defaultCalendarAPIURL) + "users/me/calendarList"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("the Calendar API is unreachable: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("the Calendar API answered %s", resp.Status)
+	}
+	return nil
+}
+
+func writeHealth(w http.ResponseWriter, status int, body healthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func getHealth(t *testing.T, url string) (int, healthStatus) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var status healthStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, status
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	env := newTestEnv(t)
+	prev := readyCheckCalendarAPI
+	t.Cleanup(func() { readyCheckCalendarAPI = prev })
+
+	if code, status := getHealth(t, env.url+"/healthz"); code != http.StatusOK || status.Status != "ok" {
+		t.Fatalf("/healthz: %d %+v", code, status)
+	}
+
+	resp, err := http.Get(env.url + "/version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var version map[string]string
+	json.NewDecoder(resp.Body).Decode(&version)
+	resp.Body.Close()
+	if version["name"] != serverName || version["version"] != serverVersion {
+		t.Fatalf("/version: %v", version)
+	}
+
+	readyCheckCalendarAPI = true
+	if code, status := getHealth(t, env.url+"/readyz"); code != http.StatusOK || status.Checks["calendar_api"] != "ok" {
+		t.Fatalf("/readyz: %d %+v", code, status)
+	}
+
+	// An unreachable Calendar API makes the server unready
+	env.fake.Close()
+	if code, status := getHealth(t, env.url+"/readyz"); code != http.StatusServiceUnavailable || status.Checks["calendar_api"] == "ok" {
+		t.Fatalf("/readyz with the Calendar API down: %d %+v", code, status)
+	}
+	readyCheckCalendarAPI = false
+
+	oauthConfig.ClientID = ""
+	if code, status := getHealth(t, env.url+"/readyz"); code != http.StatusServiceUnavailable || status.Checks["oauth"] == "ok" {
+		t.Fatalf("/readyz without a client ID: %d %+v", code, status)
+	}
+	oauthConfig.ClientID = "fake-client-id"
+
+	env.handler.draining.Store(true)
+	if code, status := getHealth(t, env.url+"/readyz"); code != http.StatusServiceUnavailable || status.Checks["shutdown"] == "" {
+		t.Fatalf("/readyz while shutting down: %d %+v", code, status)
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// icalComponent is a component of an iCalendar object (RFC 5545), such as
+// VCALENDAR or VEVENT. Only what the backends need is interpreted; other
+// properties and components are kept so they survive a rewrite.
+type icalComponent struct {
+	Name     string
+	Props    []*icalProperty
+	Children []*icalComponent
+}
+
+// icalProperty is a content line. Value is unescaped for text properties by
+// text, not by the parser.
+type icalProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+const icalDateTimeFormat = "20060102T150405"
+
+// parseICalendar parses one iCalendar object, returning its VCALENDAR.
+func parseICalendar(r io.Reader) (*icalComponent, error) {
+	lines, err := unfoldICalendar(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var stack []*icalComponent
+	var root *icalComponent
+	for _, line := range lines {
+		prop, err := parseICalendarLine(line)
+		if err != nil {
+			return nil, err
+		}
+		switch prop.Name {
+		case "BEGIN":
+			comp := &icalComponent{Name: strings.ToUpper(prop.Value)}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, comp)
+			} else if root != nil {
+				return nil, fmt.Errorf("iCalendar: more than one object")
+			}
+			stack = append(stack, comp)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(prop.Value) {
+				return nil, fmt.Errorf("iCalendar: unexpected END:%s", prop.Value)
+			}
+			if len(stack) == 1 {
+				root = stack[0]
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("iCalendar: %s outside of a component", prop.Name)
+			}
+			comp := stack[len(stack)-1]
+			comp.Props = append(comp.Props, prop)
+		}
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("iCalendar: missing END:%s", stack[len(stack)-1].Name)
+	}
+	if root == nil || root.Name != "VCALENDAR" {
+		return nil, fmt.Errorf("iCalendar: no VCALENDAR")
+	}
+	return root, nil
+}
+
+// unfoldICalendar splits r into content lines, joining folded ones.
+func unfoldICalendar(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case line == "":
+		case (line[0] == ' ' || line[0] == '\t') && len(lines) > 0:
+			lines[len(lines)-1] += line[1:]
+		default:
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// parseICalendarLine parses NAME;PARAM=value;...:VALUE.
+func parseICalendarLine(line string) (*icalProperty, error) {
+	prop := &icalProperty{}
+	i := strings.IndexAny(line, ";:")
+	if i <= 0 {
+		return nil, fmt.Errorf("iCalendar: malformed line %q", line)
+	}
+	prop.Name = strings.ToUpper(line[:i])
+	rest := line[i:]
+	for rest[0] == ';' {
+		rest = rest[1:]
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("iCalendar: malformed parameter in %q", line)
+		}
+		name := strings.ToUpper(rest[:eq])
+		rest = rest[eq+1:]
+
+		// Parameter values containing ;:, are quoted
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("iCalendar: unterminated quote in %q", line)
+			}
+			value, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			end := strings.IndexAny(rest, ";:")
+			if end < 0 {
+				return nil, fmt.Errorf("iCalendar: malformed line %q", line)
+			}
+			value, rest = rest[:end], rest[end:]
+		}
+		if prop.Params == nil {
+			prop.Params = make(map[string]string)
+		}
+		prop.Params[name] = value
+		if rest == "" {
+			return nil, fmt.Errorf("iCalendar: missing value in %q", line)
+		}
+	}
+	prop.Value = rest[1:]
+	return prop, nil
+}
+
+// encode writes c in iCalendar format, folding long lines.
+func (c *icalComponent) encode(w io.Writer) error {
+	b := &strings.Builder{}
+	c.encodeTo(b)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (c *icalComponent) encodeTo(b *strings.Builder) {
+	writeICalendarLine(b, "BEGIN:"+c.Name)
+	for _, prop := range c.Props {
+		line := prop.Name
+		for _, name := range slices.Sorted(maps.Keys(prop.Params)) {
+			value := prop.Params[name]
+			if strings.ContainsAny(value, ";:,") {
+				value = `"` + value + `"`
+			}
+			line += ";" + name + "=" + value
+		}
+		writeICalendarLine(b, line+":"+prop.Value)
+	}
+	for _, child := range c.Children {
+		child.encodeTo(b)
+	}
+	writeICalendarLine(b, "END:"+c.Name)
+}
+
+// writeICalendarLine folds line at 75 octets without splitting UTF-8
+// sequences.
+func writeICalendarLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = 74 // the leading space counts
+	}
+	b.WriteString(line + "\r\n")
+}
+
+// prop returns the first property called name, or nil.
+func (c *icalComponent) prop(name string) *icalProperty {
+	for _, prop := range c.Props {
+		if prop.Name == name {
+			return prop
+		}
+	}
+	return nil
+}
+
+// text returns the unescaped value of the text property name, or "".
+func (c *icalComponent) text(name string) string {
+	prop := c.prop(name)
+	if prop == nil {
+		return ""
+	}
+	return unescapeICalendarText(prop.Value)
+}
+
+// setText sets the text property name, removing it when value is empty.
+func (c *icalComponent) setText(name, value string) {
+	c.removeProp(name)
+	if value != "" {
+		c.Props = append(c.Props, &icalProperty{Name: name, Value: escapeICalendarText(value)})
+	}
+}
+
+func (c *icalComponent) removeProp(name string) {
+	props := c.Props[:0]
+	for _, prop := range c.Props {
+		if prop.Name != name {
+			props = append(props, prop)
+		}
+	}
+	c.Props = props
+}
+
+// events returns the VEVENT components of a VCALENDAR.
+func (c *icalComponent) events() []*icalComponent {
+	var events []*icalComponent
+	for _, child := range c.Children {
+		if child.Name == "VEVENT" {
+			events = append(events, child)
+		}
+	}
+	return events
+}
+
+var icalTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+func escapeICalendarText(s string) string {
+	return icalTextEscaper.Replace(strings.ReplaceAll(s, "\r\n", "\n"))
+}
+
+func unescapeICalendarText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// parseICalendarTime parses a DATE or DATE-TIME property. DATE-TIMEs are in
+// UTC with a Z suffix, in the zone named by TZID, or else floating, which is
+// read as local time.
+func parseICalendarTime(prop *icalProperty) (EventTime, error) {
+	value := prop.Value
+	if prop.Params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		date, err := time.Parse("20060102", value)
+		if err != nil {
+			return EventTime{}, fmt.Errorf("iCalendar: invalid %s: %w", prop.Name, err)
+		}
+		return EventTime{Time: date, AllDay: true}, nil
+	}
+
+	loc := time.Local
+	if utc, ok := strings.CutSuffix(value, "Z"); ok {
+		value, loc = utc, time.UTC
+	} else if tzid := prop.Params["TZID"]; tzid != "" {
+		if zone, err := time.LoadLocation(strings.TrimPrefix(tzid, "/")); err == nil {
+			loc = zone
+		}
+	}
+	t, err := time.ParseInLocation(icalDateTimeFormat, value, loc)
+	if err != nil {
+		return EventTime{}, fmt.Errorf("iCalendar: invalid %s: %w", prop.Name, err)
+	}
+	return EventTime{Time: t}, nil
+}
+
+// icalTimeProperty formats t as property name: a DATE for all-day times, a
+// UTC DATE-TIME otherwise.
+func icalTimeProperty(name string, t EventTime) *icalProperty {
+	if t.AllDay {
+		return &icalProperty{Name: name, Params: map[string]string{"VALUE": "DATE"}, Value: t.Time.Format("20060102")}
+	}
+	return &icalProperty{Name: name, Value: t.Time.UTC().Format(icalDateTimeFormat) + "Z"}
+}
+
+// parseICalendarDuration parses the DURATION values events use, such as
+// PT1H30M or P1D.
+func parseICalendarDuration(value string) (time.Duration, error) {
+	s := value
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign, s = -1, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	s, ok := strings.CutPrefix(s, "P")
+	if !ok || s == "" {
+		return 0, fmt.Errorf("iCalendar: invalid DURATION %q", value)
+	}
+
+	var d time.Duration
+	inTime := false
+	for s != "" {
+		if s[0] == 'T' {
+			inTime, s = true, s[1:]
+			continue
+		}
+		n := 0
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			n = n*10 + int(s[i]-'0')
+			i++
+		}
+		if i == 0 || i == len(s) {
+			return 0, fmt.Errorf("iCalendar: invalid DURATION %q", value)
+		}
+		var unit time.Duration
+		switch {
+		case !inTime && s[i] == 'W':
+			unit = 7 * 24 * time.Hour
+		case !inTime && s[i] == 'D':
+			unit = 24 * time.Hour
+		case inTime && s[i] == 'H':
+			unit = time.Hour
+		case inTime && s[i] == 'M':
+			unit = time.Minute
+		case inTime && s[i] == 'S':
+			unit = time.Second
+		default:
+			return 0, fmt.Errorf("iCalendar: invalid DURATION %q", value)
+		}
+		d += time.Duration(n) * unit
+		s = s[i+1:]
+	}
+	return sign * d, nil
+}
+
+// eventFromICalendar converts a VEVENT. The ID is left for the caller, who
+// knows how the event is addressed.
+func eventFromICalendar(vevent *icalComponent) (*Event, error) {
+	dtstart := vevent.prop("DTSTART")
+	if dtstart == nil {
+		return nil, fmt.Errorf("iCalendar: VEVENT without DTSTART")
+	}
+	start, err := parseICalendarTime(dtstart)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without DTEND, an event lasts its DURATION, else a day or no time at all
+	end := start
+	if start.AllDay {
+		end.Time = start.Time.AddDate(0, 0, 1)
+	}
+	if dtend := vevent.prop("DTEND"); dtend != nil {
+		if end, err = parseICalendarTime(dtend); err != nil {
+			return nil, err
+		}
+	} else if duration := vevent.prop("DURATION"); duration != nil {
+		d, err := parseICalendarDuration(duration.Value)
+		if err != nil {
+			return nil, err
+		}
+		end.Time = start.Time.Add(d)
+	}
+
+	return &Event{
+		Summary:     vevent.text("SUMMARY"),
+		Description: vevent.text("DESCRIPTION"),
+		Location:    vevent.text("LOCATION"),
+		Start:       start,
+		End:         end,
+		Status:      strings.ToLower(vevent.text("STATUS")),
+		HTMLLink:    vevent.text("URL"),
+	}, nil
+}
+
+// newICalendarEvent returns a VCALENDAR holding event as a VEVENT with uid.
+func newICalendarEvent(uid string, event *Event) *icalComponent {
+	vevent := &icalComponent{Name: "VEVENT"}
+	vevent.setText("UID", uid)
+	vevent.Props = append(vevent.Props,
+		icalTimeProperty("DTSTAMP", EventTime{Time: time.Now()}),
+		icalTimeProperty("DTSTART", event.Start),
+		icalTimeProperty("DTEND", event.End),
+	)
+	vevent.setText("SUMMARY", event.Summary)
+	vevent.setText("DESCRIPTION", event.Description)
+	vevent.setText("LOCATION", event.Location)
+	vcalendar := newICalendar()
+	vcalendar.Children = append(vcalendar.Children, vevent)
+	return vcalendar
+}
+
+// newICalendar returns an empty VCALENDAR.
+func newICalendar() *icalComponent {
+	return &icalComponent{
+		Name: "VCALENDAR",
+		Props: []*icalProperty{
+			{Name: "VERSION", Value: "2.0"},
+			{Name: "PRODID", Value: "-//google-calendar-mcp//EN"},
+		},
+	}
+}
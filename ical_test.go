@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseICalendar(t *testing.T) {
+	data := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:standup@example.com\r\n" +
+		"SUMMARY:Standup\\, daily\r\n" +
+		"DESCRIPTION:First line\\nsecond line that goes on for long enough to be fol\r\n" +
+		" ded\r\n" +
+		"LOCATION;LANGUAGE=en:Room 1\r\n" +
+		"DTSTART;TZID=Europe/Berlin:20250602T090000\r\n" +
+		"DURATION:PT15M\r\n" +
+		"STATUS:CONFIRMED\r\n" +
+		"BEGIN:VALARM\r\n" +
+		"ACTION:DISPLAY\r\n" +
+		"END:VALARM\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:holiday@example.com\r\n" +
+		"SUMMARY:Holiday\r\n" +
+		"DTSTART;VALUE=DATE:20250609\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	vcalendar, err := parseICalendar(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vevents := vcalendar.events()
+	if len(vevents) != 2 || len(vevents[0].Children) != 1 {
+		t.Fatalf("unexpected components %+v", vcalendar)
+	}
+
+	standup, err := eventFromICalendar(vevents[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	start := time.Date(2025, 6, 2, 9, 0, 0, 0, berlin)
+	if standup.Summary != "Standup, daily" || standup.Location != "Room 1" || standup.Status != "confirmed" {
+		t.Fatalf("unexpected event %+v", standup)
+	}
+	if standup.Description != "First line\nsecond line that goes on for long enough to be folded" {
+		t.Fatalf("unexpected description %q", standup.Description)
+	}
+	if !standup.Start.Time.Equal(start) || !standup.End.Time.Equal(start.Add(15*time.Minute)) {
+		t.Fatalf("unexpected times %v to %v", standup.Start, standup.End)
+	}
+
+	holiday, err := eventFromICalendar(vevents[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !holiday.Start.AllDay || holiday.Start.String() != "2025-06-09" || holiday.End.String() != "2025-06-10" {
+		t.Fatalf("expected a one-day event, got %v to %v", holiday.Start, holiday.End)
+	}
+
+	if _, err := parseICalendar(strings.NewReader("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nEND:VCALENDAR\r\n")); err == nil {
+		t.Fatal("expected mismatched components to fail")
+	}
+}
+
+func TestICalendarRoundTrip(t *testing.T) {
+	event := &Event{
+		Summary:     "Planning; Q3, all teams",
+		Description: strings.Repeat("Agenda ünd notes. ", 10),
+		Location:    `Room "A"`,
+		Start:       EventTime{Time: time.Date(2025, 6, 2, 10, 0, 0, 0, time.UTC)},
+		End:         EventTime{Time: time.Date(2025, 6, 2, 11, 0, 0, 0, time.UTC)},
+	}
+	var b strings.Builder
+	if err := newICalendarEvent("planning", event).encode(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(b.String(), "\r\n") {
+		if len(line) > 75 {
+			t.Fatalf("line not folded: %q", line)
+		}
+	}
+
+	vcalendar, err := parseICalendar(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vevent := vcalendar.events()[0]
+	if vevent.text("UID") != "planning" {
+		t.Fatalf("unexpected UID %q", vevent.text("UID"))
+	}
+	got, err := eventFromICalendar(vevent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Summary != event.Summary || got.Description != event.Description || got.Location != event.Location ||
+		!got.Start.Time.Equal(event.Start.Time) || !got.End.Time.Equal(event.End.Time) {
+		t.Fatalf("expected %+v, got %+v", event, got)
+	}
+}
+
+func TestParseICalendarDuration(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"PT1H30M": 90 * time.Minute,
+		"P1D":     24 * time.Hour,
+		"P1W":     7 * 24 * time.Hour,
+		"-PT15M":  -15 * time.Minute,
+		"P1DT12H": 36 * time.Hour,
+	} {
+		got, err := parseICalendarDuration(value)
+		if err != nil || got != want {
+			t.Errorf("%s: expected %v, got %v (%v)", value, want, got, err)
+		}
+	}
+	for _, value := range []string{"", "P", "1H", "PT1D", "P1H"} {
+		if _, err := parseICalendarDuration(value); err == nil {
+			t.Errorf("%s: expected an error", value)
+		}
+	}
+}
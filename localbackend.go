@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// newLocalAccount builds an account serving calendars from local files, for
+// demos, CI and machines without access to Google. paths lists .ics files
+// and vdir directories, separated by the OS path list separator.
+func newLocalAccount(paths string) (*account, error) {
+	backend, err := newLocalBackend(filepath.SplitList(paths))
+	if err != nil {
+		return nil, err
+	}
+	return &account{
+		ID:      "local:" + paths,
+		Email:   "local",
+		Name:    paths,
+		Scopes:  caldavAccountScopes,
+		Backend: backend,
+
+		Local: true,
+	}, nil
+}
+
+// localBackend is a CalendarBackend reading and writing iCalendar files. A
+// calendar is either a single .ics file holding all its events, or a vdir
+// collection: a directory with one .ics file per event, as kept by vdirsyncer
+// and khal. Files are read on every call, so changes made by other programs
+// show up right away.
+//
+// Events of a .ics file are identified by their UID, those of a vdir
+// collection by their file name without ".ics". Instances of recurring events
+// have Google-style IDs: the event's ID, "_" and their original start.
+type localBackend struct {
+	mu        sync.Mutex // serializes writes
+	calendars []*localCalendar
+}
+
+type localCalendar struct {
+	Calendar
+	path string
+	dir  bool
+}
+
+// localObject is what an event ID addresses: the VEVENTs with one UID,
+// including the overrides of a recurring event's instances.
+type localObject struct {
+	ID      string
+	VEvents []*icalComponent
+}
+
+// newLocalBackend opens calendars at paths, the first of which is primary. A
+// directory with .ics files is a vdir collection; any other directory holds
+// one collection per subdirectory. An empty .ics file is an empty calendar.
+func newLocalBackend(paths []string) (*localBackend, error) {
+	b := &localBackend{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			if err := b.addFile(path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		isCollection := slices.ContainsFunc(entries, func(entry fs.DirEntry) bool {
+			return !entry.IsDir() && strings.HasSuffix(entry.Name(), ".ics")
+		})
+		if isCollection {
+			b.addCollection(path)
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				b.addCollection(filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	if len(b.calendars) == 0 {
+		return nil, fmt.Errorf("no calendars in %s", strings.Join(paths, ", "))
+	}
+	for i, cal := range b.calendars {
+		if slices.ContainsFunc(b.calendars[:i], func(other *localCalendar) bool { return other.ID == cal.ID }) {
+			return nil, fmt.Errorf("two calendars are called %s", cal.ID)
+		}
+	}
+	b.calendars[0].Primary = true
+	return b, nil
+}
+
+func (b *localBackend) addFile(path string) error {
+	id := strings.TrimSuffix(filepath.Base(path), ".ics")
+	cal := &localCalendar{Calendar: Calendar{ID: id, Summary: id}, path: path}
+	vcalendar, err := cal.readFile()
+	if err != nil {
+		return err
+	}
+	if name := vcalendar.text("X-WR-CALNAME"); name != "" {
+		cal.Summary = name
+	}
+	cal.TimeZone = vcalendar.text("X-WR-TIMEZONE")
+	b.calendars = append(b.calendars, cal)
+	return nil
+}
+
+func (b *localBackend) addCollection(path string) {
+	id := filepath.Base(path)
+	cal := &localCalendar{Calendar: Calendar{ID: id, Summary: id}, path: path, dir: true}
+	// vdir keeps metadata in files named after the property
+	if name, err := os.ReadFile(filepath.Join(path, "displayname")); err == nil && len(bytes.TrimSpace(name)) > 0 {
+		cal.Summary = string(bytes.TrimSpace(name))
+	}
+	b.calendars = append(b.calendars, cal)
+}
+
+func (b *localBackend) ListCalendars(ctx context.Context) ([]*Calendar, error) {
+	calendars := make([]*Calendar, 0, len(b.calendars))
+	for _, cal := range b.calendars {
+		calendar := cal.Calendar
+		calendars = append(calendars, &calendar)
+	}
+	return calendars, nil
+}
+
+func (b *localBackend) ListEvents(ctx context.Context, calendarID string, query EventQuery) ([]*Event, error) {
+	cal, err := b.calendar(calendarID)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := cal.objects()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*Event
+	for _, obj := range objects {
+		instances, err := expandICalendarEvents(obj.VEvents, query.TimeMin, query.TimeMax)
+		if err != nil {
+			return nil, fmt.Errorf("event %s: %w", obj.ID, err)
+		}
+		for _, instance := range instances {
+			instance.Event.ID = obj.ID
+			if !instance.RecurrenceID.Time.IsZero() {
+				instance.Event.ID = instanceID(obj.ID, instance.RecurrenceID)
+			}
+			events = append(events, instance.Event)
+		}
+	}
+	slices.SortStableFunc(events, func(a, b *Event) int { return a.Start.Time.Compare(b.Start.Time) })
+	if query.MaxResults > 0 && int64(len(events)) > query.MaxResults {
+		events = events[:query.MaxResults]
+	}
+	return events, nil
+}
+
+func (b *localBackend) GetEvent(ctx context.Context, calendarID, eventID string) (*Event, error) {
+	cal, err := b.calendar(calendarID)
+	if err != nil {
+		return nil, err
+	}
+	obj, recurrenceID, err := cal.object(eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	var event *Event
+	if recurrenceID.IsZero() {
+		vevent := obj.VEvents[0]
+		for _, candidate := range obj.VEvents {
+			if candidate.prop("RECURRENCE-ID") == nil {
+				vevent = candidate
+				break
+			}
+		}
+		event, err = eventFromICalendar(vevent)
+	} else {
+		event, err = icalInstanceAt(obj.VEvents, recurrenceID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("event %s: %w", eventID, err)
+	}
+	event.ID = eventID
+	return event, nil
+}
+
+func (b *localBackend) CreateEvent(ctx context.Context, calendarID string, event *Event) (*Event, error) {
+	cal, err := b.calendar(calendarID)
+	if err != nil {
+		return nil, err
+	}
+	uid := make([]byte, 16)
+	rand.Read(uid)
+	id := hex.EncodeToString(uid)
+	vcalendar := newICalendarEvent(id, event)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if cal.dir {
+		err = writeICalendarFile(filepath.Join(cal.path, id+".ics"), vcalendar)
+	} else {
+		var existing *icalComponent
+		if existing, err = cal.readFile(); err == nil {
+			existing.Children = append(existing.Children, vcalendar.Children...)
+			err = writeICalendarFile(cal.path, existing)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	created := *event
+	created.ID = id
+	created.Status = "confirmed"
+	return &created, nil
+}
+
+// DeleteEvent deletes a whole event, or one instance of a recurring event by
+// excluding it from the recurrence.
+func (b *localBackend) DeleteEvent(ctx context.Context, calendarID, eventID string) error {
+	cal, err := b.calendar(calendarID)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	obj, recurrenceID, err := cal.object(eventID)
+	if err != nil {
+		return err
+	}
+	if !recurrenceID.IsZero() {
+		if _, err := icalInstanceAt(obj.VEvents, recurrenceID); err != nil {
+			return fmt.Errorf("event %s: %w", eventID, err)
+		}
+	}
+
+	var vcalendar *icalComponent
+	path := cal.path
+	if cal.dir {
+		path = filepath.Join(cal.path, obj.ID+".ics")
+		if recurrenceID.IsZero() {
+			return os.Remove(path)
+		}
+		vcalendar, err = readICalendarFile(path)
+	} else {
+		vcalendar, err = cal.readFile()
+	}
+	if err != nil {
+		return err
+	}
+
+	children := vcalendar.Children[:0]
+	for _, child := range vcalendar.Children {
+		if child.Name != "VEVENT" || (!cal.dir && child.text("UID") != obj.ID) {
+			children = append(children, child)
+			continue
+		}
+		if recurrenceID.IsZero() {
+			continue // the whole event goes
+		}
+		if excludeInstance(child, recurrenceID) {
+			children = append(children, child)
+		}
+	}
+	vcalendar.Children = children
+	return writeICalendarFile(path, vcalendar)
+}
+
+func (b *localBackend) FreeBusy(ctx context.Context, calendarIDs []string, timeMin, timeMax time.Time) (map[string][]TimeRange, error) {
+	return freeBusyFromEvents(ctx, b, calendarIDs, timeMin, timeMax)
+}
+
+// Settings reports the primary calendar's time zone, if its file names one.
+// Local files have no notion of a locale, and weeks start on Monday as in
+// iCalendar.
+func (b *localBackend) Settings(ctx context.Context) (*CalendarSettings, error) {
+	settings := &CalendarSettings{TimeZone: b.calendars[0].TimeZone, WeekStart: time.Monday}
+	if settings.TimeZone == "" {
+		settings.TimeZone = "UTC"
+	}
+	return settings, nil
+}
+
+// calendar returns the calendar with id, which may be "primary".
+func (b *localBackend) calendar(id string) (*localCalendar, error) {
+	for _, cal := range b.calendars {
+		if cal.ID == id || (id == "primary" && cal.Primary) {
+			return cal, nil
+		}
+	}
+	return nil, fmt.Errorf("calendar %s not found", id)
+}
+
+// objects reads the events of cal.
+func (cal *localCalendar) objects() ([]*localObject, error) {
+	if !cal.dir {
+		vcalendar, err := cal.readFile()
+		if err != nil {
+			return nil, err
+		}
+		var objects []*localObject
+		byUID := make(map[string]*localObject)
+		for _, vevent := range vcalendar.events() {
+			uid := vevent.text("UID")
+			obj, ok := byUID[uid]
+			if !ok {
+				obj = &localObject{ID: uid}
+				byUID[uid] = obj
+				objects = append(objects, obj)
+			}
+			obj.VEvents = append(obj.VEvents, vevent)
+		}
+		return objects, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(cal.path, "*.ics"))
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]*localObject, 0, len(paths))
+	for _, path := range paths {
+		vcalendar, err := readICalendarFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if vevents := vcalendar.events(); len(vevents) > 0 {
+			objects = append(objects, &localObject{ID: strings.TrimSuffix(filepath.Base(path), ".ics"), VEvents: vevents})
+		}
+	}
+	return objects, nil
+}
+
+// object returns the event an ID addresses, and for an instance of a
+// recurring event its original start.
+func (cal *localCalendar) object(id string) (*localObject, time.Time, error) {
+	objects, err := cal.objects()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	find := func(id string) *localObject {
+		for _, obj := range objects {
+			if obj.ID == id {
+				return obj
+			}
+		}
+		return nil
+	}
+	if obj := find(id); obj != nil {
+		return obj, time.Time{}, nil
+	}
+	if base, recurrenceID, ok := splitInstanceID(id); ok {
+		if obj := find(base); obj != nil {
+			return obj, recurrenceID, nil
+		}
+	}
+	return nil, time.Time{}, fmt.Errorf("event %s not found", id)
+}
+
+// readFile reads a single-file calendar, which may be empty.
+func (cal *localCalendar) readFile() (*icalComponent, error) {
+	vcalendar, err := readICalendarFile(cal.path)
+	if errors.Is(err, errEmptyICalendarFile) {
+		return newICalendar(), nil
+	}
+	return vcalendar, err
+}
+
+var errEmptyICalendarFile = errors.New("empty iCalendar file")
+
+func readICalendarFile(path string) (*icalComponent, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("%s: %w", path, errEmptyICalendarFile)
+	}
+	vcalendar, err := parseICalendar(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return vcalendar, nil
+}
+
+// writeICalendarFile replaces path atomically, so readers never see half a
+// calendar. The file keeps its mode; new ones get 0644.
+func writeICalendarFile(path string, vcalendar *icalComponent) error {
+	var data bytes.Buffer
+	if err := vcalendar.encode(&data); err != nil {
+		return err
+	}
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".*.ics.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	// CreateTemp makes files only their owner can read
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// excludeInstance takes the instance at recurrenceID out of a recurring
+// event, one VEVENT at a time: the master gets an EXDATE, and the override of
+// the instance, if vevent is it, is reported as one to drop.
+func excludeInstance(vevent *icalComponent, recurrenceID time.Time) (keep bool) {
+	prop := vevent.prop("RECURRENCE-ID")
+	if prop == nil {
+		vevent.Props = append(vevent.Props, excludedTime(vevent, recurrenceID))
+		return true
+	}
+	t, err := parseICalendarTime(prop)
+	return err != nil || !t.Time.Equal(recurrenceID)
+}
+
+// excludedTime is the EXDATE excluding the instance of vevent starting at
+// recurrenceID, in the form of its DTSTART.
+func excludedTime(vevent *icalComponent, recurrenceID time.Time) *icalProperty {
+	dtstart := vevent.prop("DTSTART")
+	start, _ := parseICalendarTime(dtstart)
+	prop := icalTimeProperty("EXDATE", EventTime{Time: recurrenceID, AllDay: start.AllDay})
+	if tzid := dtstart.Params["TZID"]; tzid != "" && !start.AllDay {
+		prop.Params = map[string]string{"TZID": tzid}
+		prop.Value = recurrenceID.In(start.Time.Location()).Format(icalDateTimeFormat)
+	}
+	return prop
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalBackendFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "personal.ics")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	backend, err := newLocalBackend([]string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBackend(t, backend)
+}
+
+func TestLocalBackendKeepsFileMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "personal.ics")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0o664); err != nil {
+		t.Fatal(err)
+	}
+	backend, err := newLocalBackend([]string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = backend.CreateEvent(context.Background(), "personal", &Event{
+		Summary: "Dentist",
+		Start:   EventTime{Time: time.Date(2025, 6, 2, 10, 0, 0, 0, time.UTC)},
+		End:     EventTime{Time: time.Date(2025, 6, 2, 11, 0, 0, 0, time.UTC)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o664 {
+		t.Errorf("expected the calendar to stay 0664, got %o", info.Mode().Perm())
+	}
+}
+
+func TestLocalBackendVdir(t *testing.T) {
+	storage := t.TempDir()
+	for _, name := range []string{"personal", "work"} {
+		if err := os.Mkdir(filepath.Join(storage, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(storage, "work", "displayname"), []byte("Work\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	backend, err := newLocalBackend([]string{storage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	calendars, err := backend.ListCalendars(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calendars) != 2 || calendars[0].ID != "personal" || calendars[1].Summary != "Work" {
+		t.Fatalf("unexpected calendars %+v", calendars)
+	}
+	testBackend(t, backend)
+}
+
+func TestLocalBackendRecurringEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "team.ics")
+	if err := os.WriteFile(path, []byte(weeklyStandup), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	backend, err := newLocalBackend([]string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	query := EventQuery{TimeMin: time.Date(2025, 6, 14, 0, 0, 0, 0, time.UTC), TimeMax: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)}
+
+	events, err := backend.ListEvents(ctx, "team", query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].ID != "standup_20250616T070000Z" || events[1].ID != "standup_20250618T070000Z" {
+		t.Fatalf("unexpected instances %+v", events)
+	}
+	event, err := backend.GetEvent(ctx, "team", events[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !event.Start.Time.Equal(events[1].Start.Time) {
+		t.Fatalf("unexpected instance %+v", event)
+	}
+
+	// Deleting an instance excludes it, deleting the event removes it all
+	if err := backend.DeleteEvent(ctx, "team", events[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if events, err = backend.ListEvents(ctx, "team", query); err != nil || len(events) != 1 {
+		t.Fatalf("expected one instance left, got %+v (%v)", events, err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "EXDATE;TZID=Europe/Berlin:20250616T090000") {
+		t.Fatalf("expected an EXDATE in %s", data)
+	}
+	if err := backend.DeleteEvent(ctx, "team", "standup"); err != nil {
+		t.Fatal(err)
+	}
+	if events, err = backend.ListEvents(ctx, "team", EventQuery{}); err != nil || len(events) != 0 {
+		t.Fatalf("expected no events left, got %+v (%v)", events, err)
+	}
+}
+
+func TestE2ELocalCalendarTools(t *testing.T) {
+	env := newTestEnv(t)
+	path := filepath.Join(t.TempDir(), "team.ics")
+	if err := os.WriteFile(path, []byte(weeklyStandup), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	acct, err := newLocalAccount(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts.setFallback(acct)
+
+	text, _ := env.call("auth", map[string]any{})
+	if !strings.Contains(text, "Already authenticated") {
+		t.Fatalf("expected no authentication to be needed, got %q", text)
+	}
+	text, _ = env.call("list_events", map[string]any{
+		"calendar_id": "primary",
+		"time_min":    "2025-06-01T00:00:00Z",
+		"time_max":    "2025-06-08T00:00:00Z",
+		"max_results": 10,
+	})
+	if !strings.Contains(text, "- Standup (2025-06-02T09:00:00+02:00)") || strings.Count(text, "- ") != 1 {
+		t.Fatalf("unexpected list_events result %q", text)
+	}
+
+	text, isError := env.call("create_event", map[string]any{
+		"calendar_id": "primary",
+		"summary":     "Retro",
+		"start_time":  "2025-06-06T14:00:00Z",
+		"end_time":    "2025-06-06T15:00:00Z",
+	})
+	if isError || !strings.Contains(text, "Event created successfully!") {
+		t.Fatalf("unexpected create_event result %q", text)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "SUMMARY:Retro") || !strings.Contains(string(data), "UID:standup") {
+		t.Fatalf("expected the event to be added to the file, got %s", data)
+	}
+}
@@ -1,175 +1,359 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
-	"google.golang.org/api/calendar/v3"
-	"google.golang.org/api/option"
 )
 
 const TOOL_ERROR_AUTHENTICATION_REQUIRED = "plz authenticate with Google Calendar and retry"
 
 var (
-	oauthConfig *oauth2.Config
-	state = "stateless" // could be a secure random value for production
-	calendarService *calendar.Service
+	oauthConfig  *oauth2.Config
+	accounts     = newAccountRegistry(nil)
+	pendingAuths = newPendingAuthStore()
 )
 
 func main() {
-	host := os.Getenv("HOST")
-	if host == "" {
-		host = "localhost" // for binding
+	cfg, err := loadConfig(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
-	advertisedHost := os.Getenv("ADVERTISED_HOST")
-	if advertisedHost == "" {
-		advertisedHost = "localhost" // for client connections
+	if err != nil {
+		log.Fatalf("Configuration error: %v", err)
 	}
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "5555"
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// A fake Google in the same process, for demos without credentials
+	endpoints := cfg.Endpoints
+	if cfg.FakeGoogle {
+		fake, err := startFakeGoogle()
+		if err != nil {
+			log.Fatalf("Fake Google error: %v", err)
+		}
+		endpoints = endpoints.or(fake)
+		cfg.OAuth.ClientID = cmp.Or(cfg.OAuth.ClientID, "fake-client-id")
 	}
 
+	readScopes = cfg.OAuth.Scopes
 	oauthConfig = &oauth2.Config{
-		ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
-		ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
-		RedirectURL:  fmt.Sprintf("http://%s:%s/auth/callback", advertisedHost, port),
-		Scopes: []string{
-			"https://www.googleapis.com/auth/userinfo.email",       // For SSO
-			"https://www.googleapis.com/auth/userinfo.profile",     // For SSO
-			"https://www.googleapis.com/auth/calendar.readonly",    // For Calendar
-			"openid",                                                // OpenID for ID token
-		},
-		Endpoint: google.Endpoint,
+		ClientID:     cfg.OAuth.ClientID,
+		ClientSecret: cfg.OAuth.ClientSecret,
+		RedirectURL:  cfg.BaseURL + "/auth/callback",
+		Scopes:       readScopes,
+		Endpoint:     configureEndpoints(endpoints),
+	}
+	oauthFlow = cfg.OAuth.Flow
+	authWaitTimeout = cfg.OAuth.WaitTimeout
+	shutdownTimeout = cfg.ShutdownTimeout
+	readyCheckCalendarAPI = cfg.ReadyCheckCalendarAPI
+	httpTransports = cfg.Transports
+	enabledTools = cfg.Tools
+
+	store, err := newTokenStoreFromConfig(cfg.TokenStore.Path, cfg.TokenStore.Key)
+	if err != nil {
+		log.Fatalf("Token store error: %v", err)
+	}
+	accounts = newAccountRegistry(store)
+	if err := accounts.restore(context.Background()); err != nil {
+		log.Fatalf("Token store error: %v", err)
 	}
 
-	// Create a new MCP server
-	mcpServer := server.NewMCPServer(
-		"Google Calendar MCP", // Name of the server
-		"0.1.0",               // Version
-		// Set listChanged to false as this example
-		// server does not emit notifications
-		// when the list of available tools changes
-		server.WithToolCapabilities(false),
-	)
+	// Service-account mode needs nobody to click through the auth tool
+	if cfg.ServiceAccount.File != "" {
+		acct, err := newServiceAccount(context.Background(), cfg.ServiceAccount.File, cfg.ServiceAccount.ImpersonateSubject)
+		if err != nil {
+			log.Fatalf("Service account error: %v", err)
+		}
+		accounts.setFallback(acct)
+		log.Printf("Acting as %s with service account %s", acct.Email, acct.Name)
+	}
 
-	// Define tools
-	setupTools(mcpServer)
+	// So do a CalDAV server and local files, which replace Google altogether
+	if cfg.CalDAV.URL != "" {
+		acct, err := newCalDAVAccount(context.Background(), cfg.CalDAV.URL, cfg.CalDAV.Username, cfg.CalDAV.Password)
+		if err != nil {
+			log.Fatalf("CalDAV error: %v", err)
+		}
+		accounts.setFallback(acct)
+		log.Printf("Acting as %s on CalDAV server %s", acct.Email, acct.Name)
+	}
+	if cfg.LocalCalendarPath != "" {
+		acct, err := newLocalAccount(cfg.LocalCalendarPath)
+		if err != nil {
+			log.Fatalf("Local calendar error: %v", err)
+		}
+		accounts.setFallback(acct)
+		log.Printf("Serving calendars from %s", acct.Name)
+	}
+
+	// A client that launched the server talks to it on stdin and stdout, and
+	// Google's redirect goes to a loopback listener for the time it takes
+	if cfg.Transport == "stdio" {
+		mcpServer := newMCPServer(nil)
+		oauthLoopback = newLoopbackCallback(net.JoinHostPort("127.0.0.1", strconv.Itoa(cfg.OAuth.CallbackPort)), handleAuthCallback(mcpServer))
+
+		// Stopping to read also cancels the call in progress, so wait for
+		// it first
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-signals.Done()
+			log.Printf("Shutting down, waiting up to %s for tool calls to finish", shutdownTimeout)
+			authWaits.completeAll(authResult{Err: errShuttingDown})
+			waitCtx, cancelWait := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancelWait()
+			if err := toolCalls.wait(waitCtx); err != nil {
+				log.Printf("Tool calls still in progress: %v", err)
+			}
+			cancel()
+		}()
+		log.Printf("Serving MCP on stdin and stdout")
+		if err := serveStdio(ctx, mcpServer, os.Stdin, os.Stdout); err != nil && !errors.Is(err, context.Canceled) {
+			log.Fatalf("Server error: %v", err)
+		}
+		accounts.flush()
+		return
+	}
+
+	// Require Google bearer tokens on the MCP endpoints
+	var guard *resourceGuard
+	if cfg.MCPAuth.Required {
+		audiences := append([]string{oauthConfig.ClientID}, cfg.MCPAuth.Audiences...)
+		guard = newResourceGuard(cfg.BaseURL, newGoogleTokenVerifier(audiences...))
+	} else {
+		log.Printf("MCP endpoints are unauthenticated; set MCP_AUTH_REQUIRED=true to require bearer tokens")
+	}
+
+	handler := newHandler(cfg.BaseURL, guard)
+	srv := &http.Server{Addr: cfg.listenAddr(), Handler: handler}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+	log.Printf("Server listening at http://%s", cfg.listenAddr())
+	select {
+	case err := <-serveErr:
+		log.Fatalf("Server error: %v", err)
+	case <-signals.Done():
+	}
+
+	// Closing the listener stops new connections while the sessions wind
+	// down; the remaining connections close once their streams end
+	log.Printf("Shutting down, waiting up to %s for tool calls to finish", shutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	closed := make(chan error, 1)
+	go func() {
+		closed <- srv.Shutdown(ctx)
+	}()
+	if err := handler.shutdown(ctx); err != nil {
+		log.Printf("Tool calls still in progress: %v", err)
+	}
+	if err := <-closed; err != nil {
+		log.Printf("Closing connections: %v", err)
+		srv.Close()
+	}
+	accounts.flush()
+	log.Printf("Server stopped")
+}
+
+// newHandler builds the MCP server with its tools and returns the HTTP
+// handler serving it at baseURL over httpTransports, together with the OAuth
+// endpoints and the health probes. With a guard, the MCP endpoints require
+// bearer tokens.
+func newHandler(baseURL string, guard *resourceGuard) *mcpHandler {
+	mcpServer := newMCPServer(guard)
+	h := &mcpHandler{mcp: mcpServer, streamable: newStreamableServer(mcpServer)}
+	h.sseClosed, h.closeSSE = context.WithCancel(context.Background())
 
 	sseServer := server.NewSSEServer(mcpServer,
-		server.WithBaseURL(fmt.Sprintf("http://%s:%s", advertisedHost, port)),
+		server.WithBaseURL(baseURL),
 		server.WithStaticBasePath("/mcp"),
 	)
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/auth/callback", handleAuthCallback(mcpServer))
-	mux.Handle("/mcp/sse", sseServer.SSEHandler())
-	mux.Handle("/mcp/message", sseServer.MessageHandler())
-
-	log.Printf("Server listening at http://%s:%s", host, port)
-	if err := http.ListenAndServe(fmt.Sprintf("%s:%s", host, port), mux); err != nil {
-		log.Fatalf("Server error: %v", err)
+	// Probes stay open to orchestrators, with or without a guard
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", h.handleReadyz)
+	mux.HandleFunc("/version", handleVersion)
+	if accounts.fallbackAccount() == nil {
+		mux.HandleFunc("/auth/callback", handleAuthCallback(mcpServer))
+	}
+	var logoutHandler http.Handler = http.HandlerFunc(handleLogout)
+	sseHandler, messageHandler := h.closeWithServer(sseServer.SSEHandler()), sseServer.MessageHandler()
+	var streamableHandler http.Handler = h.streamable
+	if guard != nil {
+		mux.HandleFunc(protectedResourceURI, guard.handleMetadata)
+		mux.HandleFunc(protectedResourceURI+"/mcp", guard.handleMetadata)
+		logoutHandler = guard.protect(logoutHandler)
+		sseHandler, messageHandler = guard.protect(sseHandler), guard.protect(messageHandler)
+		streamableHandler = guard.protect(streamableHandler)
+	}
+	mux.Handle("/auth/logout", logoutHandler)
+	if slices.Contains(httpTransports, transportSSE) {
+		mux.Handle("/mcp/sse", sseHandler)
+		mux.Handle("/mcp/message", messageHandler)
 	}
+	if slices.Contains(httpTransports, transportStreamable) {
+		mux.Handle("/mcp", streamableHandler)
+	}
+	h.Handler = mux
+	return h
 }
-func handleAuthCallback(server *server.MCPServer) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		code := r.URL.Query().Get("code")
-		token, err := oauthConfig.Exchange(context.Background(), code)
-		if err != nil {
-			fmt.Println("token exchange failed")
-			http.Error(w, "token exchange failed", http.StatusInternalServerError)
-			return
-		}
 
-		forMethod := r.URL.Query().Get("state")
-		if state == "" {
-			fmt.Println("state is required")
-			http.Error(w, "state is required", http.StatusBadRequest)
-			return
-		}
+// newMCPServer builds the MCP server with its tools, whatever the transport.
+// With a guard, sessions are bound to the bearer identity that opens them.
+func newMCPServer(guard *resourceGuard) *server.MCPServer {
+	// Forget which account a session acted as once it disconnects
+	hooks := &server.Hooks{}
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		accounts.unbind(session.SessionID())
+		deviceAuths.cancel(session.SessionID())
+		pendingCalls.forget(session.SessionID())
+		authWaits.complete(session.SessionID(), authResult{Err: fmt.Errorf("the MCP session closed")})
+	})
+	if guard != nil {
+		hooks.AddOnRegisterSession(guard.registerSession)
+		hooks.AddOnUnregisterSession(guard.unregisterSession)
+	}
 
-		// Initialize the global calendarService
-		tokenSource := oauthConfig.TokenSource(context.Background(), token)
-		srv, err := calendar.NewService(context.Background(), option.WithTokenSource(tokenSource))
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Unable to create Calendar service: %v", err), http.StatusInternalServerError)
-			return
-		}
-		calendarService = srv
-
-		// Notify the client to continue the method that requested authentication
-		// Note: Some MCP clients may not support this yet. e.g. Cursor
-		fmt.Println("sending notification to client")
-		server.SendNotificationToClient(
-			context.Background(),
-			forMethod,
-			map[string]any{},
-		)
-		fmt.Println("sent notification to client")
+	// Create a new MCP server
+	mcpServer := server.NewMCPServer(
+		serverName,    // Name of the server
+		serverVersion, // Version
+		// Set listChanged to false as this example
+		// server does not emit notifications
+		// when the list of available tools changes
+		server.WithToolCapabilities(false),
+		server.WithLogging(),
+		server.WithHooks(hooks),
+		// A bug in a handler fails its call rather than the whole process
+		server.WithRecovery(),
+		server.WithToolHandlerMiddleware(resumeAfterAuthorization),
+		server.WithToolHandlerMiddleware(toolCalls.middleware),
+	)
+
+	// Define tools
+	setupTools(mcpServer)
+	if len(enabledTools) > 0 {
+		var disabled []string
+		for _, name := range toolNames {
+			if !slices.Contains(enabledTools, name) {
+				disabled = append(disabled, name)
+			}
+		}
+		mcpServer.DeleteTools(disabled...)
 	}
+	return mcpServer
 }
 
 func setupTools(s *server.MCPServer) {
 	// Lazy auth tool
 	authTool := mcp.NewTool("auth",
-		mcp.WithDescription("Authenticate with Google Calendar to use the other tools. Use it when you run into authentication issues."),
+		mcp.WithDescription("Authenticate with Google Calendar to use the other tools. Use it when you run into authentication issues, or to link another Google account."),
 		mcp.WithString("for_method",
 			mcp.Description("The method that requires authentication"),
 		),
 	)
 
 	s.AddTool(authTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		// FIXME: Protocol support of multi-turn tool responses is not finalized / implemented yet.
-		// Latest support: https://modelcontextprotocol.io/specification/2025-03-26/basic/utilities/progress
-		// Discussion: https://github.com/modelcontextprotocol/modelcontextprotocol/discussions/314
-		// Difference of MCP and A2D: https://docs.google.com/document/d/18aW0P38h14ccJTkN-irhy2NVdG-_V_Oe7WblnAiKKGM/edit?tab=t.0
-
-		// session := server.ClientSessionFromContext(ctx)
-		// url := oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline)
-		// session.NotificationChannel() <- mcp.JSONRPCNotification{
-		// 	Notification: mcp.Notification{
-		// 		Method: "Please visit this URL to authenticate: " + url,
-		// 	},
-		// }
-
-		// for {
-		// 	select {
-		// 	case <-ctx.Done():
-		// 		if calendarService != nil {
-		// 			return mcp.NewToolResultText("Authentication timed out. Please try again."), nil
-		// 		}
-		// 		break
-		// 	default:
-		// 		if calendarService != nil {
-		// 			break
-		// 		}
-		// 		time.Sleep(2 * time.Second)
-		// 	}
-		// }
-
-		args := request.Params.Arguments.(map[string]any)
-		forMethod, _ := args["for_method"].(string)
-
-		// Copy oauthConfig and add for_method to the redirect URL
-		newConfig := *oauthConfig // shallow copy is fine since all fields are value or immutable
-		// FIXME: Google OAuth2 is strict about the redirect URL, so we need to use a different approach
-		// redirectURL, _ := url.Parse(oauthConfig.RedirectURL)
-		// query := redirectURL.Query()
-		// query.Set("for_method", forMethod)
-		// redirectURL.RawQuery = query.Encode()
-		// fmt.Println(redirectURL.String())
-		// newConfig.RedirectURL = redirectURL.String()
-
-		url := newConfig.AuthCodeURL(forMethod, oauth2.AccessTypeOffline)
-		return mcp.NewToolResultText(fmt.Sprintf("Please visit this URL to authenticate: %s", url)), nil
+		forMethod := request.GetString("for_method", "")
+
+		if acct := accounts.fallbackAccount(); acct != nil {
+			return mcp.NewToolResultText(fmt.Sprintf("Already authenticated as %s (%s), no action needed.", acct.Email, acct.method())), nil
+		}
+
+		// Ask up front for whatever the method that needs authentication requires
+		target, err := newAuthTarget(ctx, forMethod, scopesForTool(forMethod))
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		// Block until the user finishes consent, so clients that ignore the
+		// for_method notification still learn when to continue
+		result, err := awaitAuthorization(ctx, s, request, target)
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText(result), nil
+	})
+
+	// Auth status tool
+	authStatusTool := mcp.NewTool("auth_status",
+		mcp.WithDescription("Report whether this session is authenticated with Google Calendar, as which accounts, with which scopes, and when the access tokens expire. Use it before other tools to decide whether to call auth."),
+	)
+
+	s.AddTool(authStatusTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		all := accounts.accountsFor(principalFromContext(ctx))
+		if len(all) == 0 {
+			return mcp.NewToolResultText("Authenticated: no\nUse the auth tool to connect a Google account."), nil
+		}
+
+		result := "Authenticated: yes\n"
+		for i, acct := range all {
+			if i > 0 {
+				result += "\n"
+			}
+			result += fmt.Sprintf("Account: %s\nEmail: %s\nAccount ID: %s\nMethod: %s\n",
+				acct.Name, acct.Email, acct.ID, acct.method())
+			if len(all) > 1 && i == 0 {
+				result += "Default: yes\n"
+			}
+			if acct.Token == nil {
+				// A password grants everything and does not expire
+				continue
+			}
+			result += "Granted scopes:\n"
+			for _, scope := range acct.Scopes {
+				result += fmt.Sprintf("- %s\n", scope)
+			}
+
+			token, err := acct.Token.Token()
+			switch {
+			case err != nil:
+				result += fmt.Sprintf("Access token: unavailable (%v), use the auth tool to reconnect\n", err)
+			case token.Expiry.IsZero():
+				result += "Access token expires: never\n"
+			case token.RefreshToken != "" || acct.ServiceAccount:
+				result += fmt.Sprintf("Access token expires: %s (renewed automatically)\n", token.Expiry.Format(time.RFC3339))
+			default:
+				result += fmt.Sprintf("Access token expires: %s (use the auth tool again afterwards)\n", token.Expiry.Format(time.RFC3339))
+			}
+		}
+
+		return mcp.NewToolResultText(result), nil
+	})
+
+	// Logout tool
+	logoutTool := mcp.NewTool("logout",
+		mcp.WithDescription("Disconnect Google accounts of this session and revoke their access. Calendar tools require the auth tool again afterwards."),
+		mcp.WithString("account",
+			mcp.Description("Email of the linked Google account to disconnect (optional, defaults to all linked accounts)"),
+		),
+	)
+
+	s.AddTool(logoutTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		selector := request.GetString("account", "")
+		result, err := logout(ctx, principalFromContext(ctx), selector)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Unable to log out: %v", err)), nil
+		}
+		return mcp.NewToolResultText(result), nil
 	})
 
 	// Get current time tool
@@ -182,8 +366,7 @@ func setupTools(s *server.MCPServer) {
 	)
 
 	s.AddTool(getCurrentTimeTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		args := request.Params.Arguments.(map[string]any)
-		timezone := args["timezone"].(string)
+		timezone := request.GetString("timezone", "UTC")
 
 		loc, err := time.LoadLocation(timezone)
 		if err != nil {
@@ -197,20 +380,37 @@ func setupTools(s *server.MCPServer) {
 	// List calendars tool
 	listCalendarsTool := mcp.NewTool("list_calendars",
 		mcp.WithDescription("List all accessible Google Calendars"),
+		mcp.WithString("account",
+			mcp.Description("Email of the linked Google account to list (optional, defaults to all linked accounts)"),
+		),
 	)
 
 	s.AddTool(listCalendarsTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		if calendarService == nil {
-			return mcp.NewToolResultError(TOOL_ERROR_AUTHENTICATION_REQUIRED), nil
-		}
-		calendarList, err := calendarService.CalendarList.List().Do()
-		if err != nil {
-			return mcp.NewToolResultText(fmt.Sprintf("Error listing calendars: %v", err)), nil
+		selector := request.GetString("account", "")
+		accts, errResult := requireAccounts(ctx, "list_calendars", selector)
+		if errResult != nil {
+			return errResult, nil
 		}
 
-		result := "Available Calendars:\n"
-		for _, item := range calendarList.Items {
-			result += fmt.Sprintf("- %s (ID: %s)\n", item.Summary, item.Id)
+		result := ""
+		for _, acct := range accts {
+			calendars, err := acct.Backend.ListCalendars(ctx)
+			if err != nil {
+				if len(accts) == 1 {
+					return mcp.NewToolResultText(fmt.Sprintf("Error listing calendars: %v", err)), nil
+				}
+				result += fmt.Sprintf("Error listing calendars of %s: %v\n", acct.Email, err)
+				continue
+			}
+
+			if len(accts) == 1 {
+				result += "Available Calendars:\n"
+			} else {
+				result += fmt.Sprintf("Available Calendars of %s:\n", acct.Email)
+			}
+			for _, item := range calendars {
+				result += fmt.Sprintf("- %s (ID: %s)\n", item.Summary, item.ID)
+			}
 		}
 
 		return mcp.NewToolResultText(result), nil
@@ -233,45 +433,68 @@ func setupTools(s *server.MCPServer) {
 			mcp.Description("Maximum number of events to return"),
 			mcp.DefaultNumber(10),
 		),
+		mcp.WithString("account",
+			mcp.Description("Email of the linked Google account to list (optional, defaults to a merged view of all linked accounts)"),
+		),
 	)
 
 	s.AddTool(listEventsTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		if calendarService == nil {
-			return mcp.NewToolResultError(TOOL_ERROR_AUTHENTICATION_REQUIRED), nil
+		selector := request.GetString("account", "")
+		accts, errResult := requireAccounts(ctx, "list_events", selector)
+		if errResult != nil {
+			return errResult, nil
+		}
+		calendarID := request.GetString("calendar_id", "primary")
+		maxResults := int64(request.GetFloat("max_results", 10))
+
+		query := EventQuery{MaxResults: maxResults}
+		var err error
+		if timeMin := request.GetString("time_min", ""); timeMin != "" {
+			if query.TimeMin, err = time.Parse(time.RFC3339, timeMin); err != nil {
+				return mcp.NewToolResultText(fmt.Sprintf("Error listing events: time_min is not RFC3339: %v", err)), nil
+			}
 		}
-		args := request.Params.Arguments.(map[string]any)
-		calendarID := args["calendar_id"].(string)
-		maxResults := int64(args["max_results"].(float64))
-
-		call := calendarService.Events.List(calendarID).
-			MaxResults(maxResults).
-			SingleEvents(true).
-			OrderBy("startTime")
 
-		if timeMin, ok := args["time_min"].(string); ok && timeMin != "" {
-			call = call.TimeMin(timeMin)
+		if timeMax := request.GetString("time_max", ""); timeMax != "" {
+			if query.TimeMax, err = time.Parse(time.RFC3339, timeMax); err != nil {
+				return mcp.NewToolResultText(fmt.Sprintf("Error listing events: time_max is not RFC3339: %v", err)), nil
+			}
 		}
 
-		if timeMax, ok := args["time_max"].(string); ok && timeMax != "" {
-			call = call.TimeMax(timeMax)
+		var items []accountEvent
+		var failures string
+		for _, acct := range accts {
+			events, err := acct.Backend.ListEvents(ctx, calendarID, query)
+			if err != nil {
+				if len(accts) == 1 {
+					return mcp.NewToolResultText(fmt.Sprintf("Error listing events: %v", err)), nil
+				}
+				failures += fmt.Sprintf("Error listing events of %s: %v\n", acct.Email, err)
+				continue
+			}
+			for _, item := range events {
+				items = append(items, accountEvent{Account: acct, Event: item})
+			}
 		}
 
-		events, err := call.Do()
-		if err != nil {
-			return mcp.NewToolResultText(fmt.Sprintf("Error listing events: %v", err)), nil
+		// Interleave the accounts by start time, then apply the limit again
+		sortEventsByStart(items)
+		if int64(len(items)) > maxResults {
+			items = items[:maxResults]
 		}
 
-		if len(events.Items) == 0 {
-			return mcp.NewToolResultText("No events found."), nil
+		if len(items) == 0 {
+			return mcp.NewToolResultText(failures + "No events found."), nil
 		}
 
-		result := fmt.Sprintf("Events in calendar %s:\n", calendarID)
-		for _, item := range events.Items {
-			date := item.Start.DateTime
-			if date == "" {
-				date = item.Start.Date
+		result := failures + fmt.Sprintf("Events in calendar %s:\n", calendarID)
+		for _, item := range items {
+			date := item.Event.Start.String()
+			if len(accts) == 1 {
+				result += fmt.Sprintf("- %s (%s)\n", item.Event.Summary, date)
+			} else {
+				result += fmt.Sprintf("- %s (%s) [%s]\n", item.Event.Summary, date, item.Account.Email)
 			}
-			result += fmt.Sprintf("- %s (%s)\n", item.Summary, date)
 		}
 
 		return mcp.NewToolResultText(result), nil
@@ -285,57 +508,77 @@ func setupTools(s *server.MCPServer) {
 			mcp.DefaultString("primary"),
 		),
 		mcp.WithString("summary",
+			mcp.Required(),
 			mcp.Description("Event title/summary"),
 		),
 		mcp.WithString("description",
 			mcp.Description("Event description (optional)"),
 		),
 		mcp.WithString("start_time",
+			mcp.Required(),
 			mcp.Description("Event start time (RFC3339 format, e.g., '2024-01-01T10:00:00Z')"),
 		),
 		mcp.WithString("end_time",
+			mcp.Required(),
 			mcp.Description("Event end time (RFC3339 format, e.g., '2024-01-01T11:00:00Z')"),
 		),
 		mcp.WithString("location",
 			mcp.Description("Event location (optional)"),
 		),
+		mcp.WithString("account",
+			mcp.Description("Email of the linked Google account to create the event in (optional, defaults to the first linked account)"),
+		),
 	)
 
 	s.AddTool(createEventTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		if calendarService == nil {
-			return mcp.NewToolResultError(TOOL_ERROR_AUTHENTICATION_REQUIRED), nil
+		selector := request.GetString("account", "")
+		acct, errResult := requireAccount(ctx, "create_event", selector)
+		if errResult != nil {
+			return errResult, nil
+		}
+		calendarID := request.GetString("calendar_id", "primary")
+		summary, err := request.RequireString("summary")
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error creating event: %v", err)), nil
+		}
+		startArg, err := request.RequireString("start_time")
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error creating event: %v", err)), nil
+		}
+		endArg, err := request.RequireString("end_time")
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error creating event: %v", err)), nil
+		}
+		startTime, err := time.Parse(time.RFC3339, startArg)
+		if err != nil {
+			return mcp.NewToolResultText(fmt.Sprintf("Error creating event: start_time is not RFC3339: %v", err)), nil
+		}
+		endTime, err := time.Parse(time.RFC3339, endArg)
+		if err != nil {
+			return mcp.NewToolResultText(fmt.Sprintf("Error creating event: end_time is not RFC3339: %v", err)), nil
 		}
-		args := request.Params.Arguments.(map[string]any)
-		calendarID := args["calendar_id"].(string)
-		summary := args["summary"].(string)
-		startTime := args["start_time"].(string)
-		endTime := args["end_time"].(string)
 
-		event := &calendar.Event{
+		event := &Event{
 			Summary: summary,
-			Start: &calendar.EventDateTime{
-				DateTime: startTime,
-			},
-			End: &calendar.EventDateTime{
-				DateTime: endTime,
-			},
+			Start:   EventTime{Time: startTime},
+			End:     EventTime{Time: endTime},
 		}
 
-		if description, ok := args["description"].(string); ok && description != "" {
+		if description := request.GetString("description", ""); description != "" {
 			event.Description = description
 		}
 
-		if location, ok := args["location"].(string); ok && location != "" {
+		if location := request.GetString("location", ""); location != "" {
 			event.Location = location
 		}
 
-		createdEvent, err := calendarService.Events.Insert(calendarID, event).Do()
+		createdEvent, err := acct.Backend.CreateEvent(ctx, calendarID, event)
 		if err != nil {
 			return mcp.NewToolResultText(fmt.Sprintf("Error creating event: %v", err)), nil
 		}
 
-		result := fmt.Sprintf("Event created successfully!\nTitle: %s\nID: %s\nHTML Link: %s",
-			createdEvent.Summary, createdEvent.Id, createdEvent.HtmlLink)
+		result := fmt.Sprintf("Event created successfully!\nTitle: %s\nID: %s\nHTML Link: %s\nAccount: %s",
+			createdEvent.Summary, createdEvent.ID, createdEvent.HTMLLink, acct.Email)
 
 		return mcp.NewToolResultText(result), nil
 	})
@@ -348,31 +591,36 @@ func setupTools(s *server.MCPServer) {
 			mcp.DefaultString("primary"),
 		),
 		mcp.WithString("event_id",
+			mcp.Required(),
 			mcp.Description("The event ID"),
 		),
+		mcp.WithString("account",
+			mcp.Description("Email of the linked Google account the event belongs to (optional, defaults to searching all linked accounts)"),
+		),
 	)
 
 	s.AddTool(getEventTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		if calendarService == nil {
-			return mcp.NewToolResultError(TOOL_ERROR_AUTHENTICATION_REQUIRED), nil
+		selector := request.GetString("account", "")
+		accts, errResult := requireAccounts(ctx, "get_event", selector)
+		if errResult != nil {
+			return errResult, nil
 		}
-		args := request.Params.Arguments.(map[string]any)
-		calendarID := args["calendar_id"].(string)
-		eventID := args["event_id"].(string)
-
-		event, err := calendarService.Events.Get(calendarID, eventID).Do()
+		calendarID := request.GetString("calendar_id", "primary")
+		eventID, err := request.RequireString("event_id")
 		if err != nil {
-			return mcp.NewToolResultText(fmt.Sprintf("Error getting event: %v", err)), nil
+			return mcp.NewToolResultError(fmt.Sprintf("Error getting event: %v", err)), nil
 		}
 
-		startTime := event.Start.DateTime
-		if startTime == "" {
-			startTime = event.Start.Date
+		// Event IDs are only unique per calendar, so take the first account that has it
+		var event *Event
+		for _, acct := range accts {
+			event, err = acct.Backend.GetEvent(ctx, calendarID, eventID)
+			if err == nil {
+				break
+			}
 		}
-
-		endTime := event.End.DateTime
-		if endTime == "" {
-			endTime = event.End.Date
+		if err != nil {
+			return mcp.NewToolResultText(fmt.Sprintf("Error getting event: %v", err)), nil
 		}
 
 		result := fmt.Sprintf(`Event Details:
@@ -385,11 +633,11 @@ Status: %s
 HTML Link: %s`,
 			event.Summary,
 			event.Description,
-			startTime,
-			endTime,
+			event.Start,
+			event.End,
 			event.Location,
 			event.Status,
-			event.HtmlLink)
+			event.HTMLLink)
 
 		return mcp.NewToolResultText(result), nil
 	})
@@ -402,24 +650,31 @@ HTML Link: %s`,
 			mcp.DefaultString("primary"),
 		),
 		mcp.WithString("event_id",
+			mcp.Required(),
 			mcp.Description("The event ID to delete"),
 		),
+		mcp.WithString("account",
+			mcp.Description("Email of the linked Google account the event belongs to (required when several accounts are linked)"),
+		),
 	)
 
 	s.AddTool(deleteEventTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		if calendarService == nil {
-			return mcp.NewToolResultError(TOOL_ERROR_AUTHENTICATION_REQUIRED), nil
+		selector := request.GetString("account", "")
+		acct, errResult := requireExplicitAccount(ctx, "delete_event", selector)
+		if errResult != nil {
+			return errResult, nil
 		}
-		args := request.Params.Arguments.(map[string]any)
-		calendarID := args["calendar_id"].(string)
-		eventID := args["event_id"].(string)
-
-		err := calendarService.Events.Delete(calendarID, eventID).Do()
+		calendarID := request.GetString("calendar_id", "primary")
+		eventID, err := request.RequireString("event_id")
 		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Error deleting event: %v", err)), nil
+		}
+
+		if err := acct.Backend.DeleteEvent(ctx, calendarID, eventID); err != nil {
 			return mcp.NewToolResultText(fmt.Sprintf("Error deleting event: %v", err)), nil
 		}
 
 		result := fmt.Sprintf("Event %s deleted successfully from calendar %s", eventID, calendarID)
 		return mcp.NewToolResultText(result), nil
 	})
-}
\ No newline at end of file
+}
@@ -2,272 +2,382 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/calendar/v3"
+
+	"google-calendar-mcp/fakegoogle"
 )
 
-func TestTimeout(t *testing.T) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // Always call cancel to release resources
+// testEnv is the server as main sets it up, backed by a fake Google and
+// driven by an MCP client over SSE, or another transport.
+type testEnv struct {
+	t             *testing.T
+	fake          *fakegoogle.Server
+	url           string
+	handler       *mcpHandler
+	client        *client.Client
+	notifications chan mcp.JSONRPCNotification
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	return newTestEnvOver(t, transportSSE)
+}
+
+func newTestEnvOver(t *testing.T, transport string) *testEnv {
+	t.Helper()
+	fake := fakegoogle.New()
+	t.Cleanup(fake.Close)
+
+	prevConfig, prevAccounts := oauthConfig, accounts
+	prevURLs := []string{googleUserInfoURL, googleRevokeURL, googleTokenInfoURL, calendarAPIURL}
+	t.Cleanup(func() {
+		oauthConfig, accounts = prevConfig, prevAccounts
+		googleUserInfoURL, googleRevokeURL, googleTokenInfoURL, calendarAPIURL = prevURLs[0], prevURLs[1], prevURLs[2], prevURLs[3]
+	})
+	accounts = newAccountRegistry(nil)
+
+	// The handler needs the server's URL, which is only known once it runs
+	var handler *mcpHandler
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	oauthConfig = &oauth2.Config{
+		ClientID:    "fake-client-id",
+		RedirectURL: ts.URL + "/auth/callback",
+		Scopes:      readScopes,
+		Endpoint:    configureEndpoints(fakeEndpoints(fake)),
+	}
+	handler = newHandler(ts.URL, nil)
+
+	var c *client.Client
+	var err error
+	switch transport {
+	case transportStreamable:
+		c, err = client.NewStreamableHttpClient(ts.URL + "/mcp")
+	case "stdio":
+		c = newStdioTestClient(t)
+	default:
+		c, err = client.NewSSEMCPClient(ts.URL + "/mcp/sse")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	env := &testEnv{t: t, fake: fake, url: ts.URL, handler: handler, client: c, notifications: make(chan mcp.JSONRPCNotification, 100)}
+	c.OnNotification(func(notification mcp.JSONRPCNotification) {
+		env.notifications <- notification
+	})
+
+	ctx := context.Background()
+	if err := c.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initRequest.Params.ClientInfo = mcp.Implementation{Name: "e2e-test", Version: "0.0.0"}
+	if _, err := c.Initialize(ctx, initRequest); err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+// fakeEndpoints are the endpoints of fake.
+func fakeEndpoints(fake *fakegoogle.Server) googleEndpoints {
+	endpoint := fake.Endpoint()
+	return googleEndpoints{
+		AuthURL:        endpoint.AuthURL,
+		TokenURL:       endpoint.TokenURL,
+		DeviceAuthURL:  endpoint.DeviceAuthURL,
+		UserInfoURL:    fake.UserInfoURL(),
+		RevokeURL:      fake.RevokeURL(),
+		TokenInfoURL:   fake.TokenInfoURL(),
+		CalendarAPIURL: fake.CalendarURL(),
+	}
+}
+
+// principal is the MCP session ID of the client, which identifies it
+// without bearer authorization.
+func (e *testEnv) principal() string {
+	e.t.Helper()
+	switch t := e.client.GetTransport().(type) {
+	case *transport.SSE:
+		return t.GetEndpoint().Query().Get("sessionId")
+	case *transport.StreamableHTTP:
+		return t.GetSessionId()
+	}
+	e.t.Fatalf("no session ID over %T", e.client.GetTransport())
+	return ""
+}
+
+// call calls tool and returns the text of its result.
+func (e *testEnv) call(tool string, args map[string]any) (string, bool) {
+	e.t.Helper()
+	request := mcp.CallToolRequest{}
+	request.Params.Name = tool
+	request.Params.Arguments = args
+	result, err := e.client.CallTool(context.Background(), request)
+	if err != nil {
+		e.t.Fatalf("%s: %v", tool, err)
+	}
+	return resultText(result.Content), result.IsError
+}
+
+// waitNotification returns the next notification with method.
+func (e *testEnv) waitNotification(method string) mcp.JSONRPCNotification {
+	e.t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case notification := <-e.notifications:
+			if notification.Method == method {
+				return notification
+			}
+		case <-timeout:
+			e.t.Fatalf("no %s notification", method)
+		}
+	}
+}
 
+// consent follows the first URL in text, as the user would in a browser.
+func (e *testEnv) consent(text string) {
+	e.t.Helper()
+	url := regexp.MustCompile(`https?://\S+`).FindString(text)
+	if url == "" {
+		e.t.Fatalf("no URL in %q", text)
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		e.t.Fatalf("consent failed: %s", resp.Status)
+	}
+}
+
+// authenticate runs the auth tool, consenting once it sends the URL.
+func (e *testEnv) authenticate() string {
+	e.t.Helper()
+	done := make(chan string, 1)
 	go func() {
-		// Simulate some work
-		time.Sleep(6 * time.Second)
-		cancel() // Cancel the context after 2 seconds
+		text, _ := e.call("auth", nil)
+		done <- text
 	}()
-
+	notification := e.waitNotification("notifications/message")
+	e.consent(fmt.Sprint(notification.Params.AdditionalFields["data"]))
 	select {
-	case <-ctx.Done():
-		fmt.Println("Context was canceled!")
+	case text := <-done:
+		return text
 	case <-time.After(5 * time.Second):
-		fmt.Println("Time out!")
-		cancel()
+		e.t.Fatal("auth tool did not return after consent")
+		return ""
 	}
 }
 
-func TestDeadline(t *testing.T) {
-	deadline := time.Now().Add(3 * time.Second)
-	ctx, cancel := context.WithDeadline(context.Background(), deadline)
-	defer cancel()
+func resultText(content []mcp.Content) string {
+	var text strings.Builder
+	for _, c := range content {
+		if c, ok := c.(mcp.TextContent); ok {
+			text.WriteString(c.Text)
+		}
+	}
+	return text.String()
+}
 
-	select {
-	case <-ctx.Done():
-		fmt.Println("Context deadline reached!")
-	case <-time.After(5 * time.Second):
-		fmt.Println("Work completed")
+func TestE2EToolsRequireAuthentication(t *testing.T) {
+	env := newTestEnv(t)
+
+	for _, tool := range []string{"list_calendars", "list_events", "create_event", "get_event", "delete_event"} {
+		text, isError := env.call(tool, map[string]any{"calendar_id": "primary", "event_id": "x", "max_results": 10})
+		if !isError || text != TOOL_ERROR_AUTHENTICATION_REQUIRED {
+			t.Errorf("%s: expected authentication required, got %q", tool, text)
+		}
+	}
+
+	text, _ := env.call("auth_status", nil)
+	if !strings.Contains(text, "Authenticated: no") {
+		t.Errorf("auth_status: expected not authenticated, got %q", text)
+	}
+}
+
+func TestE2EGetCurrentTime(t *testing.T) {
+	env := newTestEnv(t)
+
+	for _, tc := range []struct {
+		args   map[string]any
+		zone   string
+		offset string
+	}{
+		{args: nil, zone: "UTC", offset: "Z"},
+		{args: map[string]any{"timezone": "Asia/Tokyo"}, zone: "Asia/Tokyo", offset: "+09:00"},
+	} {
+		text, isError := env.call("get_current_time", tc.args)
+		prefix := "Current time in " + tc.zone + ": "
+		if isError || !strings.HasPrefix(text, prefix) {
+			t.Fatalf("unexpected get_current_time result %q", text)
+		}
+		now, err := time.Parse(time.RFC3339, strings.TrimPrefix(text, prefix))
+		if err != nil || !strings.HasSuffix(text, tc.offset) || time.Since(now).Abs() > time.Minute {
+			t.Errorf("expected the current time in %s, got %q", tc.zone, text)
+		}
+	}
+
+	if text, _ := env.call("get_current_time", map[string]any{"timezone": "Mars/Olympus_Mons"}); !strings.Contains(text, "Invalid timezone") {
+		t.Errorf("expected an unknown timezone to fail, got %q", text)
 	}
 }
 
-// func TestAuthTool(t *testing.T) {
-// 	// Create a test MCP server
-// 	mcpServer := server.NewMCPServer(
-// 		"Google Calendar MCP",
-// 		"0.1.0",
-// 		server.WithToolCapabilities(false),
-// 	)
-
-// 	// Setup test OAuth config
-// 	oauthConfig = &oauth2.Config{
-// 		ClientID:     "test-client-id",
-// 		ClientSecret: "test-client-secret",
-// 		RedirectURL:  "http://localhost:5555/auth/callback",
-// 		Scopes: []string{
-// 			"https://www.googleapis.com/auth/userinfo.email",
-// 			"https://www.googleapis.com/auth/userinfo.profile",
-// 			"https://www.googleapis.com/auth/calendar.readonly",
-// 			"openid",
-// 		},
-// 		Endpoint: oauth2.Endpoint{
-// 			AuthURL:  "https://test.com/auth",
-// 			TokenURL: "https://test.com/token",
-// 		},
-// 	}
-
-// 	// Setup auth tool
-// 	authTool := mcp.NewTool("auth",
-// 		mcp.WithDescription("Authenticate with Google Calendar to use the other tools."),
-// 	)
-
-// 	mcpServer.AddTool(authTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-// 		url := oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline)
-// 		return mcp.NewToolResultText("Please visit this URL to authenticate: " + url), nil
-// 	})
-
-// 	// Create test request
-// 	req := httptest.NewRequest("POST", "/mcp/message", nil)
-// 	w := httptest.NewRecorder()
-
-// 	// Create SSE server and handle request
-// 	sseServer := server.NewSSEServer(mcpServer,
-// 		server.WithBaseURL("http://localhost:5555"),
-// 		server.WithStaticBasePath("/mcp"),
-// 	)
-
-// 	sseServer.MessageHandler().ServeHTTP(w, req)
-
-// 	// Verify response
-// 	if w.Code != http.StatusOK {
-// 		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
-// 	}
-// }
-
-// func TestListCalendarsTool(t *testing.T) {
-// 	// Create a test MCP server
-// 	mcpServer := server.NewMCPServer(
-// 		"Google Calendar MCP",
-// 		"0.1.0",
-// 		server.WithToolCapabilities(false),
-// 	)
-
-// 	// Setup test calendar service
-// 	calendarService = &calendar.Service{}
-
-// 	// Setup list calendars tool
-// 	listCalendarsTool := mcp.NewTool("list_calendars",
-// 		mcp.WithDescription("List all accessible Google Calendars"),
-// 	)
-
-// 	mcpServer.AddTool(listCalendarsTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-// 		return mcp.NewToolResultText("Available Calendars:\n- Test Calendar (ID: test-id)"), nil
-// 	})
-
-// 	// Create test request
-// 	req := httptest.NewRequest("POST", "/mcp/message", nil)
-// 	w := httptest.NewRecorder()
-
-// 	// Create SSE server and handle request
-// 	sseServer := server.NewSSEServer(mcpServer,
-// 		server.WithBaseURL("http://localhost:5555"),
-// 		server.WithStaticBasePath("/mcp"),
-// 	)
-
-// 	sseServer.MessageHandler().ServeHTTP(w, req)
-
-// 	// Verify response
-// 	if w.Code != http.StatusOK {
-// 		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
-// 	}
-// }
-
-// func TestListEventsTool(t *testing.T) {
-// 	// Create a test MCP server
-// 	mcpServer := server.NewMCPServer(
-// 		"Google Calendar MCP",
-// 		"0.1.0",
-// 		server.WithToolCapabilities(false),
-// 	)
-
-// 	// Setup test calendar service
-// 	calendarService = &calendar.Service{}
-
-// 	// Setup list events tool
-// 	listEventsTool := mcp.NewTool("list_events",
-// 		mcp.WithDescription("List events from a Google Calendar"),
-// 		mcp.WithString("calendar_id",
-// 			mcp.Description("The calendar ID"),
-// 			mcp.DefaultString("primary"),
-// 		),
-// 		mcp.WithNumber("max_results",
-// 			mcp.Description("Maximum number of events to return"),
-// 			mcp.DefaultNumber(10),
-// 		),
-// 	)
-
-// 	mcpServer.AddTool(listEventsTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-// 		return mcp.NewToolResultText("Events in calendar primary:\n- Test Event (2024-01-01T10:00:00Z)"), nil
-// 	})
-
-// 	// Create test request
-// 	req := httptest.NewRequest("POST", "/mcp/message", nil)
-// 	w := httptest.NewRecorder()
-
-// 	// Create SSE server and handle request
-// 	sseServer := server.NewSSEServer(mcpServer,
-// 		server.WithBaseURL("http://localhost:5555"),
-// 		server.WithStaticBasePath("/mcp"),
-// 	)
-
-// 	sseServer.MessageHandler().ServeHTTP(w, req)
-
-// 	// Verify response
-// 	if w.Code != http.StatusOK {
-// 		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
-// 	}
-// }
-
-// func TestCreateEventTool(t *testing.T) {
-// 	// Create a test MCP server
-// 	mcpServer := server.NewMCPServer(
-// 		"Google Calendar MCP",
-// 		"0.1.0",
-// 		server.WithToolCapabilities(false),
-// 	)
-
-// 	// Setup test calendar service
-// 	calendarService = &calendar.Service{}
-
-// 	// Setup create event tool
-// 	createEventTool := mcp.NewTool("create_event",
-// 		mcp.WithDescription("Create a new event in Google Calendar"),
-// 		mcp.WithString("calendar_id",
-// 			mcp.Description("The calendar ID"),
-// 			mcp.DefaultString("primary"),
-// 		),
-// 		mcp.WithString("summary",
-// 			mcp.Description("Event title/summary"),
-// 		),
-// 		mcp.WithString("start_time",
-// 			mcp.Description("Event start time"),
-// 		),
-// 		mcp.WithString("end_time",
-// 			mcp.Description("Event end time"),
-// 		),
-// 	)
-
-// 	mcpServer.AddTool(createEventTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-// 		return mcp.NewToolResultText("Event created successfully!\nTitle: Test Event\nID: test-id\nHTML Link: http://test.com"), nil
-// 	})
-
-// 	// Create test request
-// 	req := httptest.NewRequest("POST", "/mcp/message", nil)
-// 	w := httptest.NewRecorder()
-
-// 	// Create SSE server and handle request
-// 	sseServer := server.NewSSEServer(mcpServer,
-// 		server.WithBaseURL("http://localhost:5555"),
-// 		server.WithStaticBasePath("/mcp"),
-// 	)
-
-// 	sseServer.MessageHandler().ServeHTTP(w, req)
-
-// 	// Verify response
-// 	if w.Code != http.StatusOK {
-// 		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
-// 	}
-// }
-
-// func TestGetEventTool(t *testing.T) {
-// 	// Create a test MCP server
-// 	mcpServer := server.NewMCPServer(
-// 		"Google Calendar MCP",
-// 		"0.1.0",
-// 		server.WithToolCapabilities(false),
-// 	)
-
-// 	// Setup test calendar service
-// 	calendarService = &calendar.Service{}
-
-// 	// Setup get event tool
-// 	getEventTool := mcp.NewTool("get_event",
-// 		mcp.WithDescription("Get details of a specific event"),
-// 		mcp.WithString("calendar_id",
-// 			mcp.Description("The calendar ID"),
-// 			mcp.DefaultString("primary"),
-// 		),
-// 		mcp.WithString("event_id",
-// 			mcp.Description("The event ID"),
-// 		),
-// 	)
-
-// 	mcpServer.AddTool(getEventTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-// 		return mcp.NewToolResultText("Event Details:\nTitle: Test Event\nID: test-id\nStart: 2024-01-01T10:00:00Z\nEnd: 2024-01-01T11:00:00Z"), nil
-// 	})
-
-// 	// Create test request
-// 	req := httptest.NewRequest("POST", "/mcp/message", nil)
-// 	w := httptest.NewRecorder()
-
-// 	// Create SSE server and handle request
-// 	sseServer := server.NewSSEServer(mcpServer,
-// 		server.WithBaseURL("http://localhost:5555"),
-// 		server.WithStaticBasePath("/mcp"),
-// 	)
-
-// 	sseServer.MessageHandler().ServeHTTP(w, req)
-
-// 	// Verify response
-// 	if w.Code != http.StatusOK {
-// 		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
-// 	}
-// }
+func TestE2EAuthResumesPendingCall(t *testing.T) {
+	env := newTestEnv(t)
+	env.fake.AddEvent(fakegoogle.DefaultUser.Email, "primary", &calendar.Event{
+		Summary: "Standup",
+		Start:   &calendar.EventDateTime{DateTime: "2025-06-02T09:00:00Z"},
+		End:     &calendar.EventDateTime{DateTime: "2025-06-02T09:15:00Z"},
+	})
+
+	if _, isError := env.call("list_events", map[string]any{"calendar_id": "primary", "max_results": 10}); !isError {
+		t.Fatal("expected list_events to need authentication")
+	}
+	if text := env.authenticate(); !strings.Contains(text, "Authenticated as "+fakegoogle.DefaultUser.Email) {
+		t.Fatalf("unexpected auth result %q", text)
+	}
+
+	resumed := env.waitNotification(resumedToolCallMethod).Params.AdditionalFields
+	if resumed["tool"] != "list_events" {
+		t.Fatalf("expected list_events to be resumed, got %v", resumed["tool"])
+	}
+	result, _ := json.Marshal(resumed["result"])
+	if !strings.Contains(string(result), "Standup") {
+		t.Fatalf("expected the resumed result to list the event, got %s", result)
+	}
+
+	text, _ := env.call("auth_status", map[string]any{})
+	if !strings.Contains(text, "Authenticated: yes") || !strings.Contains(text, fakegoogle.DefaultUser.Email) {
+		t.Fatalf("unexpected auth_status %q", text)
+	}
+}
+
+func TestE2ECalendarTools(t *testing.T) {
+	env := newTestEnv(t)
+	env.fake.AddCalendar(fakegoogle.DefaultUser.Email, "team@example.com", "Team")
+	env.authenticate()
+
+	// Clients may leave out the arguments of tools needing none
+	text, _ := env.call("list_calendars", nil)
+	if !strings.Contains(text, "Available Calendars:") || !strings.Contains(text, "Team (ID: team@example.com)") {
+		t.Fatalf("unexpected list_calendars result %q", text)
+	}
+
+	text, _ = env.call("list_events", map[string]any{"calendar_id": "primary", "max_results": 10})
+	if text != "No events found." {
+		t.Fatalf("expected an empty calendar, got %q", text)
+	}
+
+	// Writing needs calendar.events, granted incrementally
+	// Arguments with defaults are left out throughout: calendar_id is primary
+	// and max_results 10
+	createArgs := map[string]any{
+		"summary":    "Review",
+		"start_time": "2025-06-03T14:00:00Z",
+		"end_time":   "2025-06-03T15:00:00Z",
+		"location":   "Room 1",
+	}
+	text, isError := env.call("create_event", createArgs)
+	if !isError || !strings.Contains(text, "needs permission to modify Google Calendar") {
+		t.Fatalf("expected create_event to ask for more scopes, got %q", text)
+	}
+	env.consent(text)
+	// Writes are not resumed, since the client retries them
+	if events := env.fake.Events(fakegoogle.DefaultUser.Email, "primary"); len(events) != 0 {
+		t.Fatalf("expected create_event not to be resumed, got %+v", events)
+	}
+	if text, isError := env.call("create_event", createArgs); isError {
+		t.Fatalf("create_event after granting the scope: %q", text)
+	}
+	events := env.fake.Events(fakegoogle.DefaultUser.Email, "primary")
+	if len(events) != 1 || events[0].Summary != "Review" {
+		t.Fatalf("expected create_event to create the event once, got %+v", events)
+	}
+	eventID := events[0].Id
+
+	text, _ = env.call("get_event", map[string]any{"event_id": eventID})
+	if !strings.Contains(text, "Title: Review") || !strings.Contains(text, "Location: Room 1") {
+		t.Fatalf("unexpected get_event result %q", text)
+	}
+
+	text, _ = env.call("list_events", nil)
+	if !strings.Contains(text, "- Review (2025-06-03T14:00:00Z)") {
+		t.Fatalf("unexpected list_events result %q", text)
+	}
+
+	// Required arguments left out fail the call rather than the server
+	for tool, args := range map[string]map[string]any{
+		"create_event": {"summary": "Review", "start_time": "2025-06-03T14:00:00Z"},
+		"get_event":    nil,
+		"delete_event": {"calendar_id": "primary"},
+	} {
+		if text, isError := env.call(tool, args); !isError || !strings.Contains(text, "required argument") {
+			t.Errorf("%s: expected a missing argument to fail, got %q", tool, text)
+		}
+	}
+
+	text, _ = env.call("delete_event", map[string]any{"event_id": eventID})
+	if !strings.Contains(text, "deleted successfully") {
+		t.Fatalf("unexpected delete_event result %q", text)
+	}
+
+	text, _ = env.call("get_event", map[string]any{"calendar_id": "primary", "event_id": eventID})
+	if !strings.Contains(text, "Error getting event") {
+		t.Fatalf("expected the deleted event to be gone, got %q", text)
+	}
+	text, _ = env.call("list_events", map[string]any{"calendar_id": "missing", "max_results": 10})
+	if !strings.Contains(text, "Error listing events") {
+		t.Fatalf("expected an unknown calendar to fail, got %q", text)
+	}
+	text, isError = env.call("list_events", map[string]any{"calendar_id": "primary", "max_results": 10, "account": "nobody@example.com"})
+	if !isError || !strings.Contains(text, "no linked account") {
+		t.Fatalf("expected an unknown account to fail, got %q", text)
+	}
+}
+
+func TestToolPanicFailsOnlyTheCall(t *testing.T) {
+	s := newMCPServer(nil)
+	s.AddTool(mcp.NewTool("broken"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		panic("bug")
+	})
+	response := s.HandleMessage(context.Background(), []byte(`{"jsonrpc": "2.0", "id": 1, "method": "tools/call", "params": {"name": "broken"}}`))
+	if rpcErr, ok := response.(mcp.JSONRPCError); !ok || !strings.Contains(rpcErr.Error.Message, "panic recovered") {
+		t.Fatalf("expected the panic to fail the call, got %+v", response)
+	}
+}
+
+func TestE2ELogout(t *testing.T) {
+	env := newTestEnv(t)
+	env.authenticate()
+
+	// Without arguments, every linked account is logged out
+	text, isError := env.call("logout", nil)
+	if isError || !strings.Contains(text, "Logged out "+fakegoogle.DefaultUser.Email+" and revoked its access") {
+		t.Fatalf("unexpected logout result %q", text)
+	}
+	if text, isError := env.call("list_calendars", map[string]any{}); !isError || text != TOOL_ERROR_AUTHENTICATION_REQUIRED {
+		t.Fatalf("expected list_calendars to need authentication again, got %q", text)
+	}
+	if text, isError := env.call("logout", map[string]any{}); !isError {
+		t.Fatalf("expected a second logout to fail, got %q", text)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	googleIssuer         = "https://accounts.google.com"
+	protectedResourceURI = "/.well-known/oauth-protected-resource"
+
+	// bearerPrincipalPrefix marks principals that are verified bearer
+	// identities rather than MCP sessions.
+	bearerPrincipalPrefix = "bearer:"
+
+	// bearerCacheTTL bounds how long a verified token is trusted without
+	// asking Google again, so revoked tokens stop working soon after.
+	bearerCacheTTL = 5 * time.Minute
+)
+
+var errInvalidToken = errors.New("invalid bearer token")
+
+// bearerIdentity is the verified caller behind a bearer token.
+type bearerIdentity struct {
+	Subject string
+	Email   string
+	Expires time.Time
+}
+
+type bearerIdentityKey struct{}
+
+func withBearerIdentity(ctx context.Context, identity *bearerIdentity) context.Context {
+	return context.WithValue(ctx, bearerIdentityKey{}, identity)
+}
+
+// bearerIdentityFromContext returns the verified caller of an MCP request, or
+// nil when the MCP endpoints do not require authorization.
+func bearerIdentityFromContext(ctx context.Context) *bearerIdentity {
+	identity, _ := ctx.Value(bearerIdentityKey{}).(*bearerIdentity)
+	return identity
+}
+
+// tokenVerifier checks bearer tokens presented to the MCP endpoints.
+type tokenVerifier interface {
+	Verify(ctx context.Context, token string) (*bearerIdentity, error)
+}
+
+// googleTokenVerifier accepts Google access tokens issued to one of the
+// allowed OAuth clients, checked against Google's tokeninfo endpoint.
+// Tokens minted for other applications are rejected even if valid.
+type googleTokenVerifier struct {
+	audiences    []string
+	tokenInfoURL string
+	client       *http.Client
+
+	mu    sync.Mutex
+	cache map[string]*bearerIdentity // by token hash
+	now   func() time.Time
+}
+
+func newGoogleTokenVerifier(audiences ...string) *googleTokenVerifier {
+	return &googleTokenVerifier{
+		audiences:    audiences,
+		tokenInfoURL: googleTokenInfoURL,
+		client:       http.DefaultClient,
+		cache:        make(map[string]*bearerIdentity),
+		now:          time.Now,
+	}
+}
+
+func (v *googleTokenVerifier) Verify(ctx context.Context, token string) (*bearerIdentity, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+
+	v.mu.Lock()
+	now := v.now()
+	for k, identity := range v.cache {
+		if now.After(identity.Expires) {
+			delete(v.cache, k)
+		}
+	}
+	cached, ok := v.cache[key]
+	v.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	identity, err := v.tokenInfo(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	cachedUntil := now.Add(bearerCacheTTL)
+	if identity.Expires.Before(cachedUntil) {
+		cachedUntil = identity.Expires
+	}
+	v.mu.Lock()
+	v.cache[key] = &bearerIdentity{Subject: identity.Subject, Email: identity.Email, Expires: cachedUntil}
+	v.mu.Unlock()
+	return identity, nil
+}
+
+func (v *googleTokenVerifier) tokenInfo(ctx context.Context, token string) (*bearerIdentity, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.tokenInfoURL+"?"+url.Values{"access_token": {token}}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("tokeninfo request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errInvalidToken
+	}
+
+	var info struct {
+		Audience   string `json:"aud"`
+		Authorized string `json:"azp"`
+		Subject    string `json:"sub"`
+		Email      string `json:"email"`
+		ExpiresIn  string `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("tokeninfo response is malformed: %w", err)
+	}
+	if !slices.Contains(v.audiences, info.Audience) && !slices.Contains(v.audiences, info.Authorized) {
+		return nil, fmt.Errorf("%w: issued to another client", errInvalidToken)
+	}
+	expiresIn, err := strconv.Atoi(info.ExpiresIn)
+	if err != nil || expiresIn <= 0 || info.Subject == "" {
+		return nil, errInvalidToken
+	}
+	return &bearerIdentity{
+		Subject: info.Subject,
+		Email:   info.Email,
+		Expires: v.now().Add(time.Duration(expiresIn) * time.Second),
+	}, nil
+}
+
+// protectedResourceMetadata is the OAuth 2.0 Protected Resource Metadata
+// (RFC 9728) MCP clients use to discover where to get a token.
+type protectedResourceMetadata struct {
+	Resource               string   `json:"resource"`
+	AuthorizationServers   []string `json:"authorization_servers"`
+	ScopesSupported        []string `json:"scopes_supported,omitempty"`
+	BearerMethodsSupported []string `json:"bearer_methods_supported"`
+	ResourceName           string   `json:"resource_name,omitempty"`
+}
+
+// resourceGuard makes the MCP endpoints an OAuth 2.1 protected resource as
+// the MCP authorization specification describes: requests need a valid
+// bearer token, and an MCP session may only be used by whoever opened it.
+type resourceGuard struct {
+	verifier    tokenVerifier
+	metadata    protectedResourceMetadata
+	metadataURL string
+
+	mu     sync.Mutex
+	owners map[string]string // MCP session ID -> principal that opened it
+}
+
+func newResourceGuard(baseURL string, verifier tokenVerifier) *resourceGuard {
+	return &resourceGuard{
+		verifier: verifier,
+		metadata: protectedResourceMetadata{
+			Resource:               baseURL + "/mcp",
+			AuthorizationServers:   []string{googleIssuer},
+			ScopesSupported:        []string{scopeOpenID, scopeEmail},
+			BearerMethodsSupported: []string{"header"},
+			ResourceName:           "Google Calendar MCP",
+		},
+		metadataURL: baseURL + protectedResourceURI,
+		owners:      make(map[string]string),
+	}
+}
+
+func (g *resourceGuard) handleMetadata(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(g.metadata)
+}
+
+// protect rejects requests without a valid bearer token and passes the
+// verified identity on to the tools through the request context.
+func (g *resourceGuard) protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			g.challenge(w, "")
+			return
+		}
+		identity, err := g.verifier.Verify(r.Context(), token)
+		if errors.Is(err, errInvalidToken) {
+			g.challenge(w, "invalid_token")
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		sessionID := r.URL.Query().Get("sessionId")
+		if sessionID == "" {
+			sessionID = r.Header.Get(streamableSessionHeader)
+		}
+		if sessionID != "" {
+			g.mu.Lock()
+			owner, known := g.owners[sessionID]
+			g.mu.Unlock()
+			if known && owner != bearerPrincipalPrefix+identity.Subject {
+				http.Error(w, "session belongs to another user", http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(withBearerIdentity(r.Context(), identity)))
+	})
+}
+
+func (g *resourceGuard) challenge(w http.ResponseWriter, errorCode string) {
+	challenge := fmt.Sprintf(`Bearer resource_metadata="%s"`, g.metadataURL)
+	if errorCode != "" {
+		challenge += fmt.Sprintf(`, error="%s"`, errorCode)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, "authorization required", http.StatusUnauthorized)
+}
+
+// registerSession remembers who opened an MCP session.
+func (g *resourceGuard) registerSession(ctx context.Context, session server.ClientSession) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.owners[session.SessionID()] = principalFromContext(ctx)
+}
+
+func (g *resourceGuard) unregisterSession(ctx context.Context, session server.ClientSession) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.owners, session.SessionID())
+}
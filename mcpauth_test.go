@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type staticVerifier map[string]*bearerIdentity
+
+func (v staticVerifier) Verify(ctx context.Context, token string) (*bearerIdentity, error) {
+	identity, ok := v[token]
+	if !ok {
+		return nil, errInvalidToken
+	}
+	return identity, nil
+}
+
+func TestResourceGuardChallengesMissingAndInvalidTokens(t *testing.T) {
+	guard := newResourceGuard("http://mcp.example.com", staticVerifier{})
+	handler := guard.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("unauthenticated request reached the MCP handler")
+	}))
+
+	for name, authorization := range map[string]string{
+		"missing": "",
+		"invalid": "Bearer forged",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/mcp/sse", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, w.Code)
+		}
+		challenge := w.Header().Get("WWW-Authenticate")
+		if !strings.Contains(challenge, `resource_metadata="http://mcp.example.com/.well-known/oauth-protected-resource"`) {
+			t.Errorf("%s: unexpected challenge %q", name, challenge)
+		}
+	}
+}
+
+func TestResourceGuardBindsSessionsToTheirOwner(t *testing.T) {
+	guard := newResourceGuard("http://mcp.example.com", staticVerifier{
+		"alice-token": {Subject: "alice"},
+		"bob-token":   {Subject: "bob"},
+	})
+	var principal string
+	handler := guard.protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal = principalFromContext(r.Context())
+	}))
+
+	ctx := withBearerIdentity(context.Background(), &bearerIdentity{Subject: "alice"})
+	guard.owners["session-a"] = principalFromContext(ctx)
+
+	req := httptest.NewRequest(http.MethodPost, "/mcp/message?sessionId=session-a", nil)
+	req.Header.Set("Authorization", "Bearer alice-token")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || principal != bearerPrincipalPrefix+"alice" {
+		t.Fatalf("owner: expected access as alice, got %d as %q", w.Code, principal)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/mcp/message?sessionId=session-a", nil)
+	req.Header.Set("Authorization", "Bearer bob-token")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("other user: expected 403, got %d", w.Code)
+	}
+}
+
+func TestResourceGuardMetadata(t *testing.T) {
+	guard := newResourceGuard("http://mcp.example.com", staticVerifier{})
+	w := httptest.NewRecorder()
+	guard.handleMetadata(w, httptest.NewRequest(http.MethodGet, protectedResourceURI, nil))
+
+	var metadata protectedResourceMetadata
+	if err := json.NewDecoder(w.Body).Decode(&metadata); err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Resource != "http://mcp.example.com/mcp" || len(metadata.AuthorizationServers) == 0 {
+		t.Fatalf("unexpected metadata: %+v", metadata)
+	}
+}
+
+func TestGoogleTokenVerifier(t *testing.T) {
+	calls := 0
+	tokenInfo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Query().Get("access_token") {
+		case "ours":
+			fmt.Fprint(w, `{"aud":"our-client","sub":"alice","email":"alice@example.com","expires_in":"3599"}`)
+		case "theirs":
+			fmt.Fprint(w, `{"aud":"other-client","sub":"alice","expires_in":"3599"}`)
+		default:
+			http.Error(w, `{"error":"invalid_token"}`, http.StatusBadRequest)
+		}
+	}))
+	defer tokenInfo.Close()
+
+	verifier := newGoogleTokenVerifier("our-client")
+	verifier.tokenInfoURL = tokenInfo.URL
+
+	identity, err := verifier.Verify(context.Background(), "ours")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Subject != "alice" || time.Until(identity.Expires) <= 0 {
+		t.Fatalf("unexpected identity: %+v", identity)
+	}
+	if _, err := verifier.Verify(context.Background(), "ours"); err != nil || calls != 1 {
+		t.Fatalf("expected cached verification, got err=%v after %d calls", err, calls)
+	}
+
+	if _, err := verifier.Verify(context.Background(), "theirs"); !errors.Is(err, errInvalidToken) {
+		t.Fatalf("expected token of another client to be rejected, got %v", err)
+	}
+	if _, err := verifier.Verify(context.Background(), "expired"); !errors.Is(err, errInvalidToken) {
+		t.Fatalf("expected unknown token to be rejected, got %v", err)
+	}
+}
+
+func TestBearerIdentityActsAsItsOwnGoogleAccount(t *testing.T) {
+	r := newAccountRegistry(nil)
+	r.link("session-a", &account{ID: "alice"})
+
+	if got := r.forPrincipal(bearerPrincipalPrefix + "alice"); got == nil || got.ID != "alice" {
+		t.Fatalf("expected bearer identity alice to act as account alice, got %+v", got)
+	}
+	if got := r.forPrincipal(bearerPrincipalPrefix + "bob"); got != nil {
+		t.Fatalf("expected no account for bob, got %+v", got)
+	}
+}
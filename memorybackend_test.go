@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryBackend is a CalendarBackend keeping everything in memory, for
+// tests. It starts with a primary calendar.
+type memoryBackend struct {
+	mu        sync.Mutex
+	calendars []*memoryCalendar
+	settings  CalendarSettings
+	nextID    int
+}
+
+type memoryCalendar struct {
+	Calendar
+	events []*Event
+}
+
+// newMemoryBackend returns a backend whose primary calendar has primaryID.
+func newMemoryBackend(primaryID string) *memoryBackend {
+	return &memoryBackend{
+		calendars: []*memoryCalendar{{Calendar: Calendar{ID: primaryID, Summary: primaryID, Primary: true, TimeZone: "UTC"}}},
+		settings:  CalendarSettings{TimeZone: "UTC", Locale: "en", WeekStart: time.Monday},
+	}
+}
+
+// addCalendar adds a secondary calendar.
+func (b *memoryBackend) addCalendar(id, summary string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calendars = append(b.calendars, &memoryCalendar{Calendar: Calendar{ID: id, Summary: summary, TimeZone: "UTC"}})
+}
+
+func (b *memoryBackend) ListCalendars(ctx context.Context) ([]*Calendar, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	calendars := make([]*Calendar, 0, len(b.calendars))
+	for _, cal := range b.calendars {
+		calendar := cal.Calendar
+		calendars = append(calendars, &calendar)
+	}
+	return calendars, nil
+}
+
+func (b *memoryBackend) ListEvents(ctx context.Context, calendarID string, query EventQuery) ([]*Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cal, err := b.calendar(calendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*Event
+	for _, event := range cal.events {
+		if !query.TimeMin.IsZero() && !event.End.Time.After(query.TimeMin) {
+			continue
+		}
+		if !query.TimeMax.IsZero() && !event.Start.Time.Before(query.TimeMax) {
+			continue
+		}
+		copied := *event
+		events = append(events, &copied)
+	}
+	slices.SortStableFunc(events, func(a, b *Event) int { return a.Start.Time.Compare(b.Start.Time) })
+	if query.MaxResults > 0 && int64(len(events)) > query.MaxResults {
+		events = events[:query.MaxResults]
+	}
+	return events, nil
+}
+
+func (b *memoryBackend) GetEvent(ctx context.Context, calendarID, eventID string) (*Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cal, err := b.calendar(calendarID)
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range cal.events {
+		if event.ID == eventID {
+			copied := *event
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("event %s not found", eventID)
+}
+
+func (b *memoryBackend) CreateEvent(ctx context.Context, calendarID string, event *Event) (*Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cal, err := b.calendar(calendarID)
+	if err != nil {
+		return nil, err
+	}
+	if !event.End.Time.After(event.Start.Time) {
+		return nil, fmt.Errorf("event must end after it starts")
+	}
+
+	b.nextID++
+	created := *event
+	created.ID = fmt.Sprintf("event%d", b.nextID)
+	created.Status = "confirmed"
+	cal.events = append(cal.events, &created)
+	copied := created
+	return &copied, nil
+}
+
+func (b *memoryBackend) DeleteEvent(ctx context.Context, calendarID, eventID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cal, err := b.calendar(calendarID)
+	if err != nil {
+		return err
+	}
+	for i, event := range cal.events {
+		if event.ID == eventID {
+			cal.events = slices.Delete(cal.events, i, i+1)
+			return nil
+		}
+	}
+	return fmt.Errorf("event %s not found", eventID)
+}
+
+func (b *memoryBackend) FreeBusy(ctx context.Context, calendarIDs []string, timeMin, timeMax time.Time) (map[string][]TimeRange, error) {
+	return freeBusyFromEvents(ctx, b, calendarIDs, timeMin, timeMax)
+}
+
+func (b *memoryBackend) Settings(ctx context.Context) (*CalendarSettings, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	settings := b.settings
+	return &settings, nil
+}
+
+// calendar returns the calendar with id, which may be "primary". b.mu must
+// be held.
+func (b *memoryBackend) calendar(id string) (*memoryCalendar, error) {
+	for _, cal := range b.calendars {
+		if cal.ID == id || (id == "primary" && cal.Primary) {
+			return cal, nil
+		}
+	}
+	return nil, fmt.Errorf("calendar %s not found", id)
+}
+
+// The tool handlers depend on nothing but CalendarBackend, so an in-memory
+// account serves them as well as Google does.
+func TestE2EMemoryBackendTools(t *testing.T) {
+	env := newTestEnv(t)
+	backend := newMemoryBackend("alice@example.com")
+	backend.addCalendar("team", "Team")
+	accounts.setFallback(&account{
+		ID:      "memory:alice@example.com",
+		Email:   "alice@example.com",
+		Scopes:  caldavAccountScopes,
+		Backend: backend,
+		Local:   true,
+	})
+
+	text, _ := env.call("list_calendars", nil)
+	if !strings.Contains(text, "- alice@example.com (ID: alice@example.com)") || !strings.Contains(text, "- Team (ID: team)") {
+		t.Fatalf("unexpected list_calendars result %q", text)
+	}
+
+	text, isError := env.call("create_event", map[string]any{
+		"calendar_id": "team",
+		"summary":     "Planning",
+		"start_time":  "2025-06-03T14:00:00Z",
+		"end_time":    "2025-06-03T15:00:00Z",
+	})
+	if isError || !strings.Contains(text, "ID: event1") {
+		t.Fatalf("unexpected create_event result %q", text)
+	}
+	text, _ = env.call("list_events", map[string]any{"calendar_id": "team", "max_results": 10})
+	if !strings.Contains(text, "- Planning (2025-06-03T14:00:00Z)") {
+		t.Fatalf("unexpected list_events result %q", text)
+	}
+	text, _ = env.call("get_event", map[string]any{"calendar_id": "team", "event_id": "event1"})
+	if !strings.Contains(text, "Title: Planning") {
+		t.Fatalf("unexpected get_event result %q", text)
+	}
+
+	text, _ = env.call("delete_event", map[string]any{"calendar_id": "team", "event_id": "event1"})
+	if !strings.Contains(text, "deleted successfully") {
+		t.Fatalf("unexpected delete_event result %q", text)
+	}
+	if events, _ := backend.ListEvents(context.Background(), "team", EventQuery{}); len(events) != 0 {
+		t.Fatalf("expected the event to be gone, got %+v", events)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/teambition/rrule-go"
+)
+
+// recurrenceHorizon is how far past time_min, or now, recurring events are
+// expanded when a listing has no upper bound.
+const recurrenceHorizon = 366 * 24 * time.Hour
+
+// icalInstance is an event, or one instance of a recurring event.
+type icalInstance struct {
+	UID          string
+	RecurrenceID EventTime // original start of a recurring event's instance, else zero
+	Event        *Event
+}
+
+// expandICalendarEvents returns the events among vevents that overlap
+// timeMin to timeMax, either of which may be zero, with recurring events
+// (RRULE, RDATE, EXDATE) expanded into single instances. An instance
+// overridden by a VEVENT with its RECURRENCE-ID takes the override's place,
+// or disappears when the override is cancelled.
+func expandICalendarEvents(vevents []*icalComponent, timeMin, timeMax time.Time) ([]icalInstance, error) {
+	until := timeMax
+	if until.IsZero() {
+		from := timeMin
+		if from.IsZero() || from.Before(time.Now()) {
+			from = time.Now()
+		}
+		until = from.Add(recurrenceHorizon)
+	}
+
+	var instances []icalInstance
+	overridden := make(map[string]bool) // by UID and recurrence ID
+	for _, vevent := range vevents {
+		prop := vevent.prop("RECURRENCE-ID")
+		if prop == nil {
+			continue
+		}
+		recurrenceID, err := parseICalendarTime(prop)
+		if err != nil {
+			return nil, err
+		}
+		uid := vevent.text("UID")
+		overridden[instanceID(uid, recurrenceID)] = true
+		event, err := eventFromICalendar(vevent)
+		if err != nil {
+			return nil, err
+		}
+		if event.Status != "cancelled" && eventOverlaps(event, timeMin, timeMax) {
+			instances = append(instances, icalInstance{UID: uid, RecurrenceID: recurrenceID, Event: event})
+		}
+	}
+
+	for _, vevent := range vevents {
+		if vevent.prop("RECURRENCE-ID") != nil {
+			continue
+		}
+		uid := vevent.text("UID")
+		event, err := eventFromICalendar(vevent)
+		if err != nil {
+			return nil, err
+		}
+		set, err := recurrenceSet(vevent, event.Start)
+		if err != nil {
+			return nil, err
+		}
+		if set == nil {
+			if eventOverlaps(event, timeMin, timeMax) {
+				instances = append(instances, icalInstance{UID: uid, Event: event})
+			}
+			continue
+		}
+
+		// Instances starting after timeMin less the duration still overlap
+		duration := event.End.Time.Sub(event.Start.Time)
+		after := event.Start.Time.Add(-time.Second)
+		if !timeMin.IsZero() && timeMin.Add(-duration).After(after) {
+			after = timeMin.Add(-duration)
+		}
+		for _, start := range set.Between(after, until, false) {
+			recurrenceID := EventTime{Time: start, AllDay: event.Start.AllDay}
+			if overridden[instanceID(uid, recurrenceID)] {
+				continue
+			}
+			instance := *event
+			instance.Start.Time = start
+			instance.End.Time = start.Add(duration)
+			if eventOverlaps(&instance, timeMin, timeMax) {
+				instances = append(instances, icalInstance{UID: uid, RecurrenceID: recurrenceID, Event: &instance})
+			}
+		}
+	}
+	return instances, nil
+}
+
+// icalInstanceAt returns the instance of the recurring event among vevents
+// that originally started at recurrenceID.
+func icalInstanceAt(vevents []*icalComponent, recurrenceID time.Time) (*Event, error) {
+	notFound := fmt.Errorf("no instance at %s", recurrenceID.Format(time.RFC3339))
+	for _, vevent := range vevents {
+		prop := vevent.prop("RECURRENCE-ID")
+		if prop == nil {
+			continue
+		}
+		if t, err := parseICalendarTime(prop); err != nil || !t.Time.Equal(recurrenceID) {
+			continue
+		}
+		event, err := eventFromICalendar(vevent)
+		if err != nil {
+			return nil, err
+		}
+		if event.Status == "cancelled" {
+			return nil, notFound
+		}
+		return event, nil
+	}
+
+	for _, vevent := range vevents {
+		if vevent.prop("RECURRENCE-ID") != nil {
+			continue
+		}
+		event, err := eventFromICalendar(vevent)
+		if err != nil {
+			return nil, err
+		}
+		set, err := recurrenceSet(vevent, event.Start)
+		if err != nil {
+			return nil, err
+		}
+		if set == nil {
+			continue
+		}
+		for _, start := range set.Between(recurrenceID.Add(-time.Second), recurrenceID.Add(time.Second), true) {
+			if start.Equal(recurrenceID) {
+				duration := event.End.Time.Sub(event.Start.Time)
+				event.Start.Time, event.End.Time = start, start.Add(duration)
+				return event, nil
+			}
+		}
+	}
+	return nil, notFound
+}
+
+// recurrenceSet returns when the event vevent starting at start recurs, or
+// nil if it does not.
+func recurrenceSet(vevent *icalComponent, start EventTime) (*rrule.Set, error) {
+	rules := vevent.prop("RRULE")
+	rdates, err := icalTimeList(vevent, "RDATE")
+	if err != nil {
+		return nil, err
+	}
+	if rules == nil && len(rdates) == 0 {
+		return nil, nil
+	}
+
+	set := &rrule.Set{}
+	set.DTStart(start.Time)
+	if rules != nil {
+		option, err := rrule.StrToROptionInLocation(rules.Value, start.Time.Location())
+		if err != nil {
+			return nil, fmt.Errorf("iCalendar: invalid RRULE %q: %w", rules.Value, err)
+		}
+		option.Dtstart = start.Time
+		rule, err := rrule.NewRRule(*option)
+		if err != nil {
+			return nil, fmt.Errorf("iCalendar: invalid RRULE %q: %w", rules.Value, err)
+		}
+		set.RRule(rule)
+	}
+	// The first instance is DTSTART, even when it does not match the rule
+	set.RDate(start.Time)
+	for _, rdate := range rdates {
+		set.RDate(rdate)
+	}
+	exdates, err := icalTimeList(vevent, "EXDATE")
+	if err != nil {
+		return nil, err
+	}
+	for _, exdate := range exdates {
+		set.ExDate(exdate)
+	}
+	return set, nil
+}
+
+// icalTimeList returns the times of every property called name, each of
+// which may list several. Periods are not supported and skipped.
+func icalTimeList(vevent *icalComponent, name string) ([]time.Time, error) {
+	var times []time.Time
+	for _, prop := range vevent.Props {
+		if prop.Name != name || prop.Params["VALUE"] == "PERIOD" {
+			continue
+		}
+		for _, value := range strings.Split(prop.Value, ",") {
+			t, err := parseICalendarTime(&icalProperty{Name: prop.Name, Params: prop.Params, Value: value})
+			if err != nil {
+				return nil, err
+			}
+			times = append(times, t.Time)
+		}
+	}
+	return times, nil
+}
+
+// eventOverlaps reports whether event overlaps timeMin to timeMax, either of
+// which may be zero.
+func eventOverlaps(event *Event, timeMin, timeMax time.Time) bool {
+	if !timeMin.IsZero() && !event.End.Time.After(timeMin) {
+		return false
+	}
+	if !timeMax.IsZero() && !event.Start.Time.Before(timeMax) {
+		return false
+	}
+	return true
+}
+
+// instanceID is the ID of the instance of recurring event id that
+// originally started at recurrenceID, formatted as Google does.
+func instanceID(id string, recurrenceID EventTime) string {
+	if recurrenceID.AllDay {
+		return id + "_" + recurrenceID.Time.Format("20060102")
+	}
+	return id + "_" + recurrenceID.Time.UTC().Format(icalDateTimeFormat) + "Z"
+}
+
+// splitInstanceID is the inverse of instanceID. It reports false for IDs of
+// whole events.
+func splitInstanceID(id string) (string, time.Time, bool) {
+	i := strings.LastIndexByte(id, '_')
+	if i < 0 {
+		return "", time.Time{}, false
+	}
+	recurrenceID, err := parseICalendarTime(&icalProperty{Name: "RECURRENCE-ID", Value: id[i+1:]})
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return id[:i], recurrenceID.Time, true
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const weeklyStandup = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup\r\n" +
+	"SUMMARY:Standup\r\n" +
+	"DTSTART;TZID=Europe/Berlin:20250602T090000\r\n" +
+	"DTEND;TZID=Europe/Berlin:20250602T091500\r\n" +
+	"RRULE:FREQ=WEEKLY;BYDAY=MO,WE;COUNT=6\r\n" +
+	"EXDATE;TZID=Europe/Berlin:20250604T090000\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup\r\n" +
+	"RECURRENCE-ID;TZID=Europe/Berlin:20250609T090000\r\n" +
+	"SUMMARY:Standup (moved)\r\n" +
+	"DTSTART;TZID=Europe/Berlin:20250609T110000\r\n" +
+	"DTEND;TZID=Europe/Berlin:20250609T111500\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup\r\n" +
+	"RECURRENCE-ID;TZID=Europe/Berlin:20250611T090000\r\n" +
+	"STATUS:CANCELLED\r\n" +
+	"DTSTART;TZID=Europe/Berlin:20250611T090000\r\n" +
+	"DTEND;TZID=Europe/Berlin:20250611T091500\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestExpandICalendarEvents(t *testing.T) {
+	vcalendar, err := parseICalendar(strings.NewReader(weeklyStandup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+
+	instances, err := expandICalendarEvents(vcalendar.events(), time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Six instances, less the excluded and the cancelled one
+	slices.SortFunc(instances, func(a, b icalInstance) int { return a.Event.Start.Time.Compare(b.Event.Start.Time) })
+	var got []string
+	for _, instance := range instances {
+		got = append(got, instance.Event.Summary+" "+instance.Event.Start.Time.In(berlin).Format("Jan 2 15:04"))
+	}
+	want := []string{"Standup Jun 2 09:00", "Standup (moved) Jun 9 11:00", "Standup Jun 16 09:00", "Standup Jun 18 09:00"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// An instance overlapping time_min counts
+	instances, err = expandICalendarEvents(vcalendar.events(), time.Date(2025, 6, 16, 7, 10, 0, 0, time.UTC), time.Date(2025, 6, 16, 8, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 1 || instanceID("standup", instances[0].RecurrenceID) != "standup_20250616T070000Z" {
+		t.Fatalf("expected the instance in progress, got %+v", instances)
+	}
+}
+
+func TestICalendarInstanceAt(t *testing.T) {
+	vcalendar, err := parseICalendar(strings.NewReader(weeklyStandup))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := icalInstanceAt(vcalendar.events(), time.Date(2025, 6, 16, 7, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !event.End.Time.Equal(time.Date(2025, 6, 16, 7, 15, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected instance %+v", event)
+	}
+	if event, err := icalInstanceAt(vcalendar.events(), time.Date(2025, 6, 9, 7, 0, 0, 0, time.UTC)); err != nil || event.Summary != "Standup (moved)" {
+		t.Fatalf("expected the override, got %+v (%v)", event, err)
+	}
+	for _, missing := range []time.Time{
+		time.Date(2025, 6, 4, 7, 0, 0, 0, time.UTC),  // excluded
+		time.Date(2025, 6, 11, 7, 0, 0, 0, time.UTC), // cancelled
+		time.Date(2025, 6, 3, 7, 0, 0, 0, time.UTC),  // not an instance
+	} {
+		if _, err := icalInstanceAt(vcalendar.events(), missing); err == nil {
+			t.Errorf("%s: expected no instance", missing)
+		}
+	}
+}
+
+func TestSplitInstanceID(t *testing.T) {
+	id := instanceID("team_sync", EventTime{Time: time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC)})
+	base, recurrenceID, ok := splitInstanceID(id)
+	if !ok || base != "team_sync" || !recurrenceID.Equal(time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected split of %s: %s %s %v", id, base, recurrenceID, ok)
+	}
+	if _, _, ok := splitInstanceID("team_sync"); ok {
+		t.Fatal("expected an event ID not to be an instance ID")
+	}
+}
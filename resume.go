@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// resumedToolCallMethod is the notification carrying the result of a tool
+// call that was held back until the session authenticated. Its params are
+// the tool name, the original arguments, and the CallToolResult.
+const resumedToolCallMethod = "notifications/tools/resumed"
+
+var pendingCalls = newPendingCallRegistry()
+
+// unresumableTools have side effects. Clients are told to retry a call that
+// needed authorization, so resuming these as well would run them twice,
+// e.g. create the event twice; only reads are safe to run again.
+var unresumableTools = []string{"create_event", "delete_event"}
+
+// pendingCall is a tool call that failed for lack of authorization, kept to
+// be run again once the session completes it.
+type pendingCall struct {
+	ctx     context.Context
+	request mcp.CallToolRequest
+	handler server.ToolHandlerFunc
+	expires time.Time
+}
+
+// pendingCallRegistry holds the latest pending call of each session.
+type pendingCallRegistry struct {
+	mu    sync.Mutex
+	calls map[string]*pendingCall // by session ID
+	now   func() time.Time
+}
+
+func newPendingCallRegistry() *pendingCallRegistry {
+	return &pendingCallRegistry{
+		calls: make(map[string]*pendingCall),
+		now:   time.Now,
+	}
+}
+
+// remember replaces the pending call of sessionID. It is dropped if the
+// session does not authorize within pendingAuthTTL.
+func (r *pendingCallRegistry) remember(sessionID string, call *pendingCall) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	call.expires = r.now().Add(pendingAuthTTL)
+	r.calls[sessionID] = call
+}
+
+// take removes and returns the pending call of sessionID, or nil.
+func (r *pendingCallRegistry) take(sessionID string) *pendingCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	call, ok := r.calls[sessionID]
+	delete(r.calls, sessionID)
+	if !ok || r.now().After(call.expires) {
+		return nil
+	}
+	return call
+}
+
+// forget drops the pending call of sessionID, if any.
+func (r *pendingCallRegistry) forget(sessionID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.calls, sessionID)
+}
+
+// needsAuthorization reports whether result asks the user to authenticate or
+// to grant more scopes.
+func needsAuthorization(result *mcp.CallToolResult) bool {
+	if result == nil || !result.IsError || len(result.Content) == 0 {
+		return false
+	}
+	text, ok := result.Content[0].(mcp.TextContent)
+	if !ok {
+		return false
+	}
+	insufficientScope, _, _ := strings.Cut(TOOL_ERROR_INSUFFICIENT_SCOPE, "%s")
+	return text.Text == TOOL_ERROR_AUTHENTICATION_REQUIRED || strings.HasPrefix(text.Text, insufficientScope)
+}
+
+// resumeAfterAuthorization is tool handler middleware remembering calls that
+// fail for lack of authorization, so resumeToolCall can run them again,
+// unless they are unresumableTools.
+func resumeAfterAuthorization(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := next(ctx, request)
+		if err != nil || !needsAuthorization(result) || slices.Contains(unresumableTools, request.Params.Name) {
+			return result, err
+		}
+		if session := server.ClientSessionFromContext(ctx); session != nil {
+			pendingCalls.remember(session.SessionID(), &pendingCall{
+				// The call is resumed long after this request has finished
+				ctx:     context.WithoutCancel(ctx),
+				request: request,
+				handler: next,
+			})
+		}
+		return result, err
+	}
+}
+
+// resumeToolCall runs the pending call of sessionID, if any, and delivers its
+// result to the session as a resumedToolCallMethod notification.
+func resumeToolCall(s *server.MCPServer, sessionID string) {
+	call := pendingCalls.take(sessionID)
+	if call == nil {
+		return
+	}
+
+	result, err := call.handler(call.ctx, call.request)
+	if err != nil {
+		result = mcp.NewToolResultError(err.Error())
+	}
+	err = s.SendNotificationToSpecificClient(sessionID, resumedToolCallMethod, map[string]any{
+		"tool":      call.request.Params.Name,
+		"arguments": call.request.Params.Arguments,
+		"result":    result,
+	})
+	if err != nil {
+		log.Printf("Unable to deliver resumed %s call to session %s: %v", call.request.Params.Name, sessionID, err)
+	}
+}
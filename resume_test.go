@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+type testSession struct {
+	id            string
+	notifications chan mcp.JSONRPCNotification
+}
+
+func (s *testSession) SessionID() string                                   { return s.id }
+func (s *testSession) NotificationChannel() chan<- mcp.JSONRPCNotification { return s.notifications }
+func (s *testSession) Initialize()                                         {}
+func (s *testSession) Initialized() bool                                   { return true }
+
+func TestResumeToolCallAfterAuthorization(t *testing.T) {
+	s := server.NewMCPServer("test", "0.0.0")
+	session := &testSession{id: "session-resume", notifications: make(chan mcp.JSONRPCNotification, 1)}
+	if err := s.RegisterSession(context.Background(), session); err != nil {
+		t.Fatal(err)
+	}
+	ctx := s.WithContext(context.Background(), session)
+
+	authorized := false
+	handler := resumeAfterAuthorization(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if !authorized {
+			return mcp.NewToolResultError(TOOL_ERROR_AUTHENTICATION_REQUIRED), nil
+		}
+		return mcp.NewToolResultText("2 events"), nil
+	})
+
+	var request mcp.CallToolRequest
+	request.Params.Name = "list_events"
+	request.Params.Arguments = map[string]any{"calendar_id": "primary"}
+	if result, _ := handler(ctx, request); !result.IsError {
+		t.Fatalf("expected the first call to need authentication, got %+v", result)
+	}
+
+	authorized = true
+	resumeToolCall(s, session.id)
+
+	select {
+	case notification := <-session.notifications:
+		if notification.Method != resumedToolCallMethod {
+			t.Fatalf("unexpected notification %s", notification.Method)
+		}
+		params := notification.Params.AdditionalFields
+		if params["tool"] != "list_events" {
+			t.Fatalf("unexpected tool %v", params["tool"])
+		}
+		result := params["result"].(*mcp.CallToolResult)
+		if result.IsError || result.Content[0].(mcp.TextContent).Text != "2 events" {
+			t.Fatalf("unexpected result %+v", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the resumed result to be delivered")
+	}
+
+	if call := pendingCalls.take(session.id); call != nil {
+		t.Fatal("expected the pending call to run only once")
+	}
+}
+
+func TestNeedsAuthorization(t *testing.T) {
+	for _, tc := range []struct {
+		result *mcp.CallToolResult
+		want   bool
+	}{
+		{mcp.NewToolResultError(TOOL_ERROR_AUTHENTICATION_REQUIRED), true},
+		{mcp.NewToolResultError("this tool needs permission to modify Google Calendar, plz grant it and retry. Please visit..."), true},
+		{mcp.NewToolResultError("Unable to log out: not authenticated"), false},
+		{mcp.NewToolResultText(TOOL_ERROR_AUTHENTICATION_REQUIRED), false},
+	} {
+		if got := needsAuthorization(tc.result); got != tc.want {
+			t.Errorf("needsAuthorization(%+v) = %v, want %v", tc.result.Content, got, tc.want)
+		}
+	}
+}
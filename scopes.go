@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"golang.org/x/oauth2"
+)
+
+const (
+	TOOL_ERROR_INSUFFICIENT_SCOPE = "this tool needs permission to modify Google Calendar, plz grant it and retry. %s"
+	TOOL_ERROR_ACCOUNT_REQUIRED   = "several Google accounts are linked, plz retry with the account argument set to one of: %s"
+)
+
+const (
+	scopeEmail            = "https://www.googleapis.com/auth/userinfo.email"
+	scopeProfile          = "https://www.googleapis.com/auth/userinfo.profile"
+	scopeOpenID           = "openid"
+	scopeCalendar         = "https://www.googleapis.com/auth/calendar"
+	scopeCalendarReadonly = "https://www.googleapis.com/auth/calendar.readonly"
+	scopeCalendarEvents   = "https://www.googleapis.com/auth/calendar.events"
+)
+
+// readScopes is what a session is first asked for: identity plus read-only
+// Calendar access.
+var readScopes = []string{
+	scopeEmail,            // For SSO
+	scopeProfile,          // For SSO
+	scopeCalendarReadonly, // For Calendar
+	scopeOpenID,           // OpenID for ID token
+}
+
+// toolScopes lists tools needing more than readScopes. They are granted
+// incrementally the first time such a tool is used.
+var toolScopes = map[string]string{
+	"create_event": scopeCalendarEvents,
+	"delete_event": scopeCalendarEvents,
+}
+
+// scopesForTool returns the scopes to request when authorizing for tool.
+func scopesForTool(tool string) []string {
+	scope, ok := toolScopes[tool]
+	if !ok {
+		return readScopes
+	}
+	return append(slices.Clone(readScopes), scope)
+}
+
+// hasScope reports whether granted covers want. The full calendar scope
+// implies the narrower ones.
+func hasScope(granted []string, want string) bool {
+	if slices.Contains(granted, want) {
+		return true
+	}
+	switch want {
+	case scopeCalendarReadonly, scopeCalendarEvents:
+		return slices.Contains(granted, scopeCalendar)
+	}
+	return false
+}
+
+// grantedScopes returns the scopes Google reports for token, falling back to
+// the requested ones for providers that omit them.
+func grantedScopes(token *oauth2.Token, requested []string) []string {
+	if scope, ok := token.Extra("scope").(string); ok && scope != "" {
+		return strings.Fields(scope)
+	}
+	return requested
+}
+
+// selectAccounts returns the accounts of the caller in ctx named by
+// selector, an email address or account ID, or all of them when selector is
+// empty. Otherwise it returns the tool result to send instead.
+func selectAccounts(ctx context.Context, selector string) ([]*account, *mcp.CallToolResult) {
+	principal := principalFromContext(ctx)
+	all := accounts.accountsFor(principal)
+	if len(all) == 0 {
+		return nil, mcp.NewToolResultError(TOOL_ERROR_AUTHENTICATION_REQUIRED)
+	}
+	if selector == "" {
+		return all, nil
+	}
+	acct, err := accounts.find(principal, selector)
+	if err != nil {
+		return nil, mcp.NewToolResultError(err.Error())
+	}
+	return []*account{acct}, nil
+}
+
+// requireAccounts returns the accounts tool acts as: the one named by
+// selector, or every account of the caller for a merged view. Each must hold
+// the scope tool needs.
+func requireAccounts(ctx context.Context, tool, selector string) ([]*account, *mcp.CallToolResult) {
+	all, errResult := selectAccounts(ctx, selector)
+	if errResult != nil {
+		return nil, errResult
+	}
+	for _, acct := range all {
+		if errResult := requireScope(ctx, tool, acct); errResult != nil {
+			return nil, errResult
+		}
+	}
+	return all, nil
+}
+
+// requireAccount returns the single account tool acts as: the one named by
+// selector, or else the caller's default account.
+func requireAccount(ctx context.Context, tool, selector string) (*account, *mcp.CallToolResult) {
+	all, errResult := selectAccounts(ctx, selector)
+	if errResult != nil {
+		return nil, errResult
+	}
+	if errResult := requireScope(ctx, tool, all[0]); errResult != nil {
+		return nil, errResult
+	}
+	return all[0], nil
+}
+
+// requireExplicitAccount is requireAccount for destructive tools, which must
+// not guess between several linked accounts.
+func requireExplicitAccount(ctx context.Context, tool, selector string) (*account, *mcp.CallToolResult) {
+	if selector == "" {
+		if all := accounts.accountsFor(principalFromContext(ctx)); len(all) > 1 {
+			return nil, mcp.NewToolResultError(fmt.Sprintf(TOOL_ERROR_ACCOUNT_REQUIRED, accountEmails(all)))
+		}
+	}
+	return requireAccount(ctx, tool, selector)
+}
+
+// requireScope returns nil when acct holds the scope tool needs. Otherwise it
+// returns the tool result to send instead: a prompt that upgrades the
+// existing grant of acct.
+func requireScope(ctx context.Context, tool string, acct *account) *mcp.CallToolResult {
+	scope, ok := toolScopes[tool]
+	if !ok || hasScope(acct.Scopes, scope) {
+		return nil
+	}
+
+	var prompt string
+	target, err := newAuthTarget(ctx, tool, scopesForTool(tool))
+	if err == nil {
+		prompt, err = authorizationPrompt(server.ServerFromContext(ctx), target, acct.Email)
+	}
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Unable to start authorization: %v", err))
+	}
+	return mcp.NewToolResultError(fmt.Sprintf(TOOL_ERROR_INSUFFICIENT_SCOPE, prompt))
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestHasScope(t *testing.T) {
+	if !hasScope(readScopes, scopeCalendarReadonly) {
+		t.Error("read scopes should cover calendar.readonly")
+	}
+	if hasScope(readScopes, scopeCalendarEvents) {
+		t.Error("read scopes should not cover calendar.events")
+	}
+	if !hasScope([]string{scopeCalendar}, scopeCalendarEvents) {
+		t.Error("full calendar scope should cover calendar.events")
+	}
+}
+
+func TestScopesForTool(t *testing.T) {
+	if got := scopesForTool("list_events"); !slices.Equal(got, readScopes) {
+		t.Errorf("list_events: expected read scopes, got %v", got)
+	}
+	if got := scopesForTool("create_event"); !slices.Contains(got, scopeCalendarEvents) {
+		t.Errorf("create_event: expected calendar.events, got %v", got)
+	}
+}
+
+func TestGrantedScopes(t *testing.T) {
+	token := (&oauth2.Token{}).WithExtra(map[string]any{
+		"scope": "openid " + scopeCalendarReadonly,
+	})
+	if got := grantedScopes(token, readScopes); !slices.Equal(got, []string{scopeOpenID, scopeCalendarReadonly}) {
+		t.Errorf("unexpected granted scopes: %v", got)
+	}
+	if got := grantedScopes(&oauth2.Token{}, readScopes); !slices.Equal(got, readScopes) {
+		t.Errorf("expected fallback to requested scopes, got %v", got)
+	}
+}
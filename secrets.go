@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// secretSetting is a secret that can also be read from a file, set with
+// key and env, or key_file and env_FILE.
+type secretSetting struct {
+	key, env    string
+	value, file *string
+}
+
+func (c *config) secretSettings() []secretSetting {
+	return []secretSetting{
+		{"oauth.client_secret", "GOOGLE_CLIENT_SECRET", &c.OAuth.ClientSecret, &c.OAuth.ClientSecretFile},
+		{"token_store.key", "TOKEN_STORE_KEY", &c.TokenStore.Key, &c.TokenStore.KeyFile},
+		{"caldav.password", "CALDAV_PASSWORD", &c.CalDAV.Password, &c.CalDAV.PasswordFile},
+	}
+}
+
+// preferSecrets clears the secrets and files that a source about to be
+// applied sets the counterpart of, so that a secret file overrides a secret
+// from a lower source and the other way around, as any setting does. set
+// reports whether the source sets the setting named env.
+func (c *config) preferSecrets(set func(env string) bool) {
+	for _, secret := range c.secretSettings() {
+		if set(secret.env + "_FILE") {
+			*secret.value = ""
+		}
+		if set(secret.env) {
+			*secret.file = ""
+		}
+	}
+}
+
+// readSecrets fills in the secrets configured as files, as Docker and
+// Kubernetes mount them, and the OAuth client from its client_secret.json.
+// Unlike environment variables, files show up neither in docker inspect nor
+// in process listings.
+func (c *config) readSecrets() error {
+	for _, secret := range c.secretSettings() {
+		if *secret.file == "" {
+			continue
+		}
+		name := fmt.Sprintf("%s (%s)", secret.key, secret.env)
+		fileName := fmt.Sprintf("%s_file (%s_FILE)", secret.key, secret.env)
+		// Only one source setting both is left with both
+		if *secret.value != "" {
+			return fmt.Errorf("set either %s or %s, not both", name, fileName)
+		}
+		data, err := os.ReadFile(*secret.file)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %w", fileName, err)
+		}
+		// Files written by hand usually end with a newline
+		*secret.value = strings.TrimSpace(string(data))
+	}
+
+	if c.OAuth.ClientFile == "" {
+		return nil
+	}
+	id, secret, err := readClientSecretFile(c.OAuth.ClientFile)
+	if err != nil {
+		return fmt.Errorf("oauth.client_file (GOOGLE_OAUTH_CLIENT_FILE): %w", err)
+	}
+	if c.OAuth.ClientID != "" && c.OAuth.ClientID != id {
+		return fmt.Errorf("oauth.client_id (GOOGLE_CLIENT_ID) is %s, but %s is for %s", c.OAuth.ClientID, c.OAuth.ClientFile, id)
+	}
+	if c.OAuth.ClientSecret != "" && c.OAuth.ClientSecret != secret {
+		return fmt.Errorf("oauth.client_secret (GOOGLE_CLIENT_SECRET) does not match the secret in %s", c.OAuth.ClientFile)
+	}
+	c.OAuth.ClientID, c.OAuth.ClientSecret = id, secret
+	return nil
+}
+
+// readClientSecretFile returns the OAuth client in path, a client_secret.json
+// as the Google Cloud console downloads it. Both "installed" (desktop) and
+// "web" clients work; their redirect URIs are ignored in favor of the
+// server's own.
+func readClientSecretFile(path string) (id, secret string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	type client struct {
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+	}
+	var file struct {
+		Installed *client `json:"installed"`
+		Web       *client `json:"web"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return "", "", fmt.Errorf("%s is not valid JSON: %w", path, err)
+	}
+	c := file.Installed
+	if c == nil {
+		c = file.Web
+	}
+	if c == nil || c.ClientID == "" {
+		return "", "", fmt.Errorf(`%s has no "installed" or "web" client`, path)
+	}
+	return c.ClientID, c.ClientSecret, nil
+}
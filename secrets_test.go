@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigSecretFiles(t *testing.T) {
+	env := envOf(map[string]string{
+		"GOOGLE_CLIENT_ID":          "client",
+		"GOOGLE_CLIENT_SECRET_FILE": writeConfigFile(t, "client-secret", "s3cret\n"),
+		"TOKEN_STORE_PATH":          "/var/lib/tokens.json",
+		"TOKEN_STORE_KEY_FILE":      writeConfigFile(t, "token-store-key", "a2V5"),
+	})
+	c, err := loadConfig([]string{"--caldav-url=https://dav.example.com", "--caldav-password-file", writeConfigFile(t, "caldav-password", "hunter2")}, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.OAuth.ClientSecret != "s3cret" || c.TokenStore.Key != "a2V5" || c.CalDAV.Password != "hunter2" {
+		t.Errorf("unexpected secrets %q, %q, %q", c.OAuth.ClientSecret, c.TokenStore.Key, c.CalDAV.Password)
+	}
+
+	env = envOf(map[string]string{
+		"GOOGLE_CLIENT_ID":          "client",
+		"GOOGLE_CLIENT_SECRET":      "s3cret",
+		"GOOGLE_CLIENT_SECRET_FILE": writeConfigFile(t, "client-secret", "s3cret"),
+	})
+	if _, err := loadConfig(nil, env); err == nil || !strings.Contains(err.Error(), "not both") {
+		t.Errorf("expected a secret set twice to fail, got %v", err)
+	}
+	// Across sources, a secret and its file override each other like any
+	// setting
+	path := writeConfigFile(t, "config.yaml", "oauth:\n  client_id: client\n  client_secret: from-file\ntoken_store:\n  key_file: /nonexistent\n")
+	env = envOf(map[string]string{
+		"CONFIG_FILE":               path,
+		"GOOGLE_CLIENT_SECRET_FILE": writeConfigFile(t, "client-secret", "from-env-file"),
+		"TOKEN_STORE_PATH":          "/var/lib/tokens.json",
+		"TOKEN_STORE_KEY":           "a2V5",
+		"CALDAV_PASSWORD":           "from-env",
+	})
+	c, err = loadConfig([]string{"--caldav-url=https://dav.example.com", "--caldav-password-file", writeConfigFile(t, "caldav-password", "from-flag-file")}, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.OAuth.ClientSecret != "from-env-file" || c.TokenStore.Key != "a2V5" || c.CalDAV.Password != "from-flag-file" {
+		t.Errorf("expected the secrets from the higher sources, got %q, %q, %q", c.OAuth.ClientSecret, c.TokenStore.Key, c.CalDAV.Password)
+	}
+
+	env = envOf(map[string]string{"GOOGLE_CLIENT_ID": "client", "GOOGLE_CLIENT_SECRET_FILE": "/nonexistent"})
+	if _, err := loadConfig(nil, env); err == nil || !strings.Contains(err.Error(), "GOOGLE_CLIENT_SECRET_FILE") {
+		t.Errorf("expected a missing secret file to fail, got %v", err)
+	}
+}
+
+func TestLoadConfigClientSecretFile(t *testing.T) {
+	for _, kind := range []string{"installed", "web"} {
+		t.Run(kind, func(t *testing.T) {
+			path := writeConfigFile(t, "client_secret.json", `{"`+kind+`": {
+				"client_id": "1234.apps.googleusercontent.com",
+				"project_id": "calendar",
+				"auth_uri": "https://accounts.google.com/o/oauth2/auth",
+				"token_uri": "https://oauth2.googleapis.com/token",
+				"client_secret": "GOCSPX-s3cret",
+				"redirect_uris": ["http://localhost"]
+			}}`)
+			c, err := loadConfig([]string{"--oauth-client-file", path}, envOf(nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.OAuth.ClientID != "1234.apps.googleusercontent.com" || c.OAuth.ClientSecret != "GOCSPX-s3cret" {
+				t.Errorf("unexpected client %q, secret %q", c.OAuth.ClientID, c.OAuth.ClientSecret)
+			}
+
+			env := envOf(map[string]string{"GOOGLE_CLIENT_ID": "5678.apps.googleusercontent.com"})
+			if _, err := loadConfig([]string{"--oauth-client-file", path}, env); err == nil || !strings.Contains(err.Error(), "is for 1234") {
+				t.Errorf("expected a different client ID to fail, got %v", err)
+			}
+		})
+	}
+
+	path := writeConfigFile(t, "client_secret.json", `{"type": "service_account", "client_id": "1234"}`)
+	if _, err := loadConfig([]string{"--oauth-client-file", path}, envOf(nil)); err == nil || !strings.Contains(err.Error(), `no "installed" or "web" client`) {
+		t.Errorf("expected a service-account key to fail, got %v", err)
+	}
+}
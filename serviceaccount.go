@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+)
+
+// serviceAccountScopes covers every tool. With domain-wide delegation they
+// must also be granted to the client ID in the Workspace admin console.
+var serviceAccountScopes = []string{
+	scopeCalendarReadonly,
+	scopeCalendarEvents,
+}
+
+// newServiceAccount builds an account from a service-account JSON key. When
+// subject is set, the service account impersonates that user through
+// domain-wide delegation; otherwise it acts as itself and only sees
+// calendars shared with it.
+func newServiceAccount(ctx context.Context, keyFile, subject string) (*account, error) {
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read service account key: %w", err)
+	}
+	config, err := google.JWTConfigFromJSON(key, serviceAccountScopes...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse service account key: %w", err)
+	}
+	config.Subject = subject
+
+	email := config.Email
+	if subject != "" {
+		email = subject
+	}
+	acct := &account{
+		ID:     "service-account:" + email,
+		Email:  email,
+		Name:   config.Email,
+		Scopes: serviceAccountScopes,
+		Token:  config.TokenSource(ctx),
+
+		ServiceAccount: true,
+	}
+	srv, err := calendar.NewService(ctx, calendarOptions(option.WithTokenSource(acct.Token))...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Calendar service: %w", err)
+	}
+	acct.Backend = newGoogleBackend(srv)
+	return acct, nil
+}
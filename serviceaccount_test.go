@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeServiceAccountKey(t *testing.T) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	data, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "robot@project.iam.gserviceaccount.com",
+		"private_key_id": "key-1",
+		"private_key":    string(keyPEM),
+		"token_uri":      "https://oauth2.googleapis.com/token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "service-account.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewServiceAccount(t *testing.T) {
+	keyFile := writeServiceAccountKey(t)
+
+	acct, err := newServiceAccount(context.Background(), keyFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acct.Email != "robot@project.iam.gserviceaccount.com" || acct.Backend == nil {
+		t.Fatalf("unexpected account: %+v", acct)
+	}
+	if !hasScope(acct.Scopes, scopeCalendarEvents) {
+		t.Fatalf("service account should be able to write events, has %v", acct.Scopes)
+	}
+
+	impersonating, err := newServiceAccount(context.Background(), keyFile, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if impersonating.Email != "alice@example.com" || impersonating.Name != "robot@project.iam.gserviceaccount.com" {
+		t.Fatalf("unexpected impersonating account: %+v", impersonating)
+	}
+}
+
+func TestFallbackAccountActsForUnboundPrincipals(t *testing.T) {
+	r := newAccountRegistry(nil)
+	r.setFallback(&account{ID: "service-account:robot"})
+	r.link("session-a", &account{ID: "alice"})
+
+	if got := r.forPrincipal("session-a"); got.ID != "alice" {
+		t.Fatalf("session-a: expected its own account, got %s", got.ID)
+	}
+	if got := r.forPrincipal("session-b"); got == nil || got.ID != "service-account:robot" {
+		t.Fatalf("session-b: expected fallback account, got %+v", got)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// shutdownTimeout bounds how long a graceful shutdown waits for tool calls
+// to finish before closing the sessions regardless.
+var shutdownTimeout = 25 * time.Second
+
+// sseFlushDelay is how long SSE streams stay open after the last tool call
+// finished. mcp-go queues messages for them without telling once they are
+// written, so they get a moment to send the last results.
+const sseFlushDelay = 250 * time.Millisecond
+
+var errShuttingDown = errors.New("the server is shutting down")
+
+var toolCalls = newCallTracker()
+
+// callTracker counts the requests in progress, so a shutdown can wait for
+// them.
+type callTracker struct {
+	mu     sync.Mutex
+	active int
+	idle   chan struct{} // closed while nothing is in progress
+}
+
+func newCallTracker() *callTracker {
+	idle := make(chan struct{})
+	close(idle)
+	return &callTracker{idle: idle}
+}
+
+// begin counts a request in progress until end is called.
+func (t *callTracker) begin() (end func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.active == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.active++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.active--
+			if t.active == 0 {
+				close(t.idle)
+			}
+		})
+	}
+}
+
+// middleware counts every tool call in progress.
+func (t *callTracker) middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		defer t.begin()()
+		return next(ctx, request)
+	}
+}
+
+// wait blocks until nothing is in progress, or ctx is done.
+func (t *callTracker) wait(ctx context.Context) error {
+	t.mu.Lock()
+	idle := t.idle
+	t.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// mcpHandler serves the MCP server over HTTP, together with the OAuth
+// endpoints, and shuts its sessions down gracefully.
+type mcpHandler struct {
+	http.Handler
+	mcp        *server.MCPServer
+	streamable *streamableServer
+
+	draining  atomic.Bool
+	sseClosed context.Context // done once SSE streams have to end
+	closeSSE  context.CancelFunc
+}
+
+// closeWithServer refuses new SSE streams once a shutdown started, and ends
+// those open when it closes the sessions.
+func (h *mcpHandler) closeWithServer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.draining.Load() {
+			w.Header().Set("Connection", "close")
+			http.Error(w, "The server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		ctx, cancel := context.WithCancel(r.Context())
+		defer context.AfterFunc(h.sseClosed, cancel)()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// shutdown stops accepting new sessions and tells connected clients. Tool
+// calls in progress are given until ctx is done to finish, after which
+// every session is closed. Waiting for authorization is given up on right
+// away, since users cannot complete it anymore.
+func (h *mcpHandler) shutdown(ctx context.Context) error {
+	h.draining.Store(true)
+	h.streamable.drain()
+	h.mcp.SendNotificationToAllClients("notifications/message", map[string]any{
+		"level":  mcp.LoggingLevelWarning,
+		"logger": "server",
+		"data":   "The server is shutting down. Reconnect to continue.",
+	})
+	authWaits.completeAll(authResult{Err: errShuttingDown})
+
+	err := toolCalls.wait(ctx)
+	select {
+	case <-time.After(sseFlushDelay):
+	case <-ctx.Done():
+	}
+	h.closeSSE()
+	h.streamable.closeAll(context.WithoutCancel(ctx))
+	return err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCallTracker(t *testing.T) {
+	tracker := newCallTracker()
+	if err := tracker.wait(context.Background()); err != nil {
+		t.Fatalf("expected an idle tracker not to wait, got %v", err)
+	}
+
+	end := tracker.begin()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := tracker.wait(ctx); err == nil {
+		t.Fatal("expected wait to time out while a call is in progress")
+	}
+
+	waited := make(chan error, 1)
+	go func() { waited <- tracker.wait(context.Background()) }()
+	end()
+	end() // ending twice counts once
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wait did not return once the call ended")
+	}
+	if tracker.active != 0 {
+		t.Fatalf("expected no call in progress, got %d", tracker.active)
+	}
+}
+
+func TestE2EGracefulShutdown(t *testing.T) {
+	env := newTestEnv(t)
+
+	// The auth tool is still in progress while it waits for consent
+	done := make(chan string, 1)
+	go func() {
+		text, _ := env.call("auth", map[string]any{})
+		done <- text
+	}()
+	env.waitNotification("notifications/message")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- env.handler.shutdown(ctx) }()
+
+	warning := env.waitNotification("notifications/message").Params.AdditionalFields
+	if warning["logger"] != "server" || !strings.Contains(warning["data"].(string), "shutting down") {
+		t.Errorf("expected a shutdown warning, got %v", warning)
+	}
+	select {
+	case text := <-done:
+		if !strings.Contains(text, errShuttingDown.Error()) {
+			t.Errorf("expected auth to give up on the shutdown, got %q", text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("auth did not return during the shutdown")
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	resp, err := http.Get(env.url + "/mcp/sse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected new SSE sessions to be refused, got %s", resp.Status)
+	}
+	c := &streamableClient{t: t, url: env.url + "/mcp"}
+	if resp := c.post(map[string]any{"method": "initialize", "params": map[string]any{}}); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected new Streamable HTTP sessions to be refused, got %s", resp.Status)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// serveStdio serves s to the one client on the other end of in and out, as
+// clients expect of the servers they launch, until in is closed or ctx is
+// done. Nothing else may write to out; logs go to stderr.
+//
+// mcp-go's StdioServer handles one message at a time, so a tool call waiting
+// for the user, as auth does, would hold up every other request. Tool calls
+// run concurrently here instead; other messages keep their order, so that
+// initialization completes before anything else.
+func serveStdio(ctx context.Context, s *server.MCPServer, in io.Reader, out io.Writer) error {
+	session := &stdioSession{notifications: make(chan mcp.JSONRPCNotification, 100)}
+	if err := s.RegisterSession(ctx, session); err != nil {
+		return fmt.Errorf("register session: %w", err)
+	}
+	defer s.UnregisterSession(context.Background(), session.SessionID())
+	ctx = s.WithContext(ctx, session)
+
+	// Responses and notifications are written from different goroutines
+	w := &lockedWriter{w: out}
+	write := func(message any) {
+		data, err := json.Marshal(message)
+		if err != nil {
+			log.Printf("Unable to encode MCP message: %v", err)
+			return
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			log.Printf("Unable to write MCP message: %v", err)
+		}
+	}
+	go func() {
+		for {
+			select {
+			case notification := <-session.notifications:
+				write(notification)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Reading blocks, so it goes on apart from ctx
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(in)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				select {
+				case lines <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case line := <-lines:
+			handle := func() {
+				if response := s.HandleMessage(ctx, line); response != nil {
+					write(response)
+				}
+			}
+			var message struct {
+				Method mcp.MCPMethod `json:"method"`
+			}
+			// HandleMessage reports malformed messages
+			if json.Unmarshal(line, &message) == nil && message.Method == mcp.MethodToolsCall {
+				go handle()
+			} else {
+				handle()
+			}
+		case err := <-readErr:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// stdioSession is the session of the client on stdin and stdout.
+type stdioSession struct {
+	notifications chan mcp.JSONRPCNotification
+	initialized   atomic.Bool
+	logLevel      atomic.Value
+}
+
+func (s *stdioSession) SessionID() string {
+	return "stdio"
+}
+
+func (s *stdioSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func (s *stdioSession) Initialize() {
+	s.initialized.Store(true)
+}
+
+func (s *stdioSession) Initialized() bool {
+	return s.initialized.Load()
+}
+
+func (s *stdioSession) SetLogLevel(level mcp.LoggingLevel) {
+	s.logLevel.Store(level)
+}
+
+func (s *stdioSession) GetLogLevel() mcp.LoggingLevel {
+	if level, ok := s.logLevel.Load().(mcp.LoggingLevel); ok {
+		return level
+	}
+	return mcp.LoggingLevelError
+}
+
+var _ server.SessionWithLogging = (*stdioSession)(nil)
+
+// lockedWriter serializes writes, so each message stays on a line of its own.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// oauthLoopback receives the OAuth redirects when there is no HTTP server
+// to do so, as with the stdio transport. Nil otherwise.
+var oauthLoopback *loopbackCallback
+
+// loopbackCallback is a listener for /auth/callback on 127.0.0.1, as Google
+// allows for desktop apps. It only runs while authorizations wait for their
+// callback: it starts with the first and stops once none is left, or
+// pendingAuthTTL after the last one started.
+type loopbackCallback struct {
+	addr    string // e.g. "127.0.0.1:0" for any free port
+	handler http.Handler
+
+	mu      sync.Mutex
+	server  *http.Server
+	url     string          // redirect URL while the server runs
+	waiting map[string]bool // states of the authorizations awaiting their callback
+	expiry  *time.Timer
+}
+
+func newLoopbackCallback(addr string, handler http.Handler) *loopbackCallback {
+	return &loopbackCallback{addr: addr, handler: handler}
+}
+
+// redirectURL returns the redirect URL for the authorization with state
+// about to start, starting the listener unless it runs already.
+func (l *loopbackCallback) redirectURL(state string) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.server == nil {
+		listener, err := net.Listen("tcp", l.addr)
+		if err != nil {
+			return "", fmt.Errorf("unable to listen for the OAuth callback: %w", err)
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/auth/callback", l.handleCallback)
+		l.server = &http.Server{Handler: mux}
+		l.url = fmt.Sprintf("http://%s/auth/callback", listener.Addr())
+		l.waiting = make(map[string]bool)
+		go l.server.Serve(listener)
+		log.Printf("Listening for the OAuth callback at %s", l.url)
+	}
+
+	l.waiting[state] = true
+	if l.expiry != nil {
+		l.expiry.Stop()
+	}
+	var expiry *time.Timer
+	expiry = time.AfterFunc(pendingAuthTTL, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.expiry == expiry {
+			l.stop()
+		}
+	})
+	l.expiry = expiry
+	return l.url, nil
+}
+
+// handleCallback passes the callback on to the handler. Only the callback of
+// an authorization still awaited counts towards stopping, so stray requests
+// with an invalid or used state keep the listener up for the others.
+func (l *loopbackCallback) handleCallback(w http.ResponseWriter, r *http.Request) {
+	l.handler.ServeHTTP(w, r)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	state := r.URL.Query().Get("state")
+	if !l.waiting[state] {
+		return
+	}
+	delete(l.waiting, state)
+	if len(l.waiting) == 0 {
+		l.stop()
+	}
+}
+
+// stop shuts the listener down once the requests it serves are done. l.mu
+// must be held.
+func (l *loopbackCallback) stop() {
+	if l.server == nil {
+		return
+	}
+	srv := l.server
+	go func() {
+		if err := srv.Shutdown(context.Background()); err != nil {
+			log.Printf("Stopping the OAuth callback listener: %v", err)
+		}
+	}()
+	log.Printf("Stopped listening for the OAuth callback at %s", l.url)
+	l.server, l.url, l.waiting = nil, "", nil
+	l.expiry.Stop()
+}
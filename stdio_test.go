@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+
+	"google-calendar-mcp/fakegoogle"
+)
+
+// newStdioTestClient serves the tools on pipes, as main does on stdin and
+// stdout with --transport=stdio, and returns a client on their other end.
+func newStdioTestClient(t *testing.T) *client.Client {
+	t.Helper()
+	mcpServer := newMCPServer(nil)
+	oauthLoopback = newLoopbackCallback("127.0.0.1:0", handleAuthCallback(mcpServer))
+	t.Cleanup(func() { oauthLoopback = nil })
+
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serveStdio(ctx, mcpServer, serverIn, serverOut)
+		serverOut.Close()
+	}()
+	t.Cleanup(func() {
+		cancel()
+		clientOut.Close()
+		<-done
+	})
+	return client.NewClient(transport.NewIO(clientIn, clientOut, io.NopCloser(strings.NewReader(""))))
+}
+
+func TestE2EStdioTools(t *testing.T) {
+	env := newTestEnvOver(t, "stdio")
+	env.fake.AddCalendar(fakegoogle.DefaultUser.Email, "team@example.com", "Team")
+
+	if text, isError := env.call("list_calendars", map[string]any{}); !isError || text != TOOL_ERROR_AUTHENTICATION_REQUIRED {
+		t.Fatalf("expected authentication required, got %q", text)
+	}
+	// Google redirects to the loopback listener, which is gone once used
+	if text := env.authenticate(); !strings.Contains(text, "Authenticated as "+fakegoogle.DefaultUser.Email) {
+		t.Fatalf("unexpected auth result %q", text)
+	}
+	oauthLoopback.mu.Lock()
+	stopped := oauthLoopback.server == nil
+	oauthLoopback.mu.Unlock()
+	if !stopped {
+		t.Error("expected the OAuth callback listener to stop after the callback")
+	}
+
+	text, _ := env.call("list_calendars", map[string]any{})
+	if !strings.Contains(text, "Team (ID: team@example.com)") {
+		t.Fatalf("expected the Team calendar, got %q", text)
+	}
+}
+
+func TestLoopbackCallbackIgnoresUnknownStates(t *testing.T) {
+	loopback := newLoopbackCallback("127.0.0.1:0", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	first, err := loopback.redirectURL("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loopback.redirectURL("second"); err != nil {
+		t.Fatal(err)
+	}
+	running := func() bool {
+		loopback.mu.Lock()
+		defer loopback.mu.Unlock()
+		return loopback.server != nil
+	}
+	callback := func(state string) {
+		resp, err := http.Get(first + "?state=" + state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	// Neither a bogus state nor the same one twice stands in for the
+	// second authorization
+	callback("bogus")
+	callback("first")
+	callback("first")
+	if !running() {
+		t.Fatal("expected the listener to wait for the second authorization")
+	}
+	callback("second")
+	if running() {
+		t.Error("expected the listener to stop once every authorization called back")
+	}
+}
+
+func TestE2EStdioServesCallsDuringAuth(t *testing.T) {
+	env := newTestEnvOver(t, "stdio")
+	prompt, authDone := env.authenticateAsync()
+
+	// The auth call waits for consent without holding up other calls
+	done := make(chan string, 1)
+	go func() {
+		text, _ := env.call("get_current_time", nil)
+		done <- text
+	}()
+	select {
+	case text := <-done:
+		if !strings.Contains(text, "Current time in UTC") {
+			t.Fatalf("unexpected get_current_time result %q", text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("get_current_time waited for the auth call")
+	}
+
+	env.consent(prompt)
+	if text := awaitText(t, authDone); !strings.Contains(text, "Authenticated as "+fakegoogle.DefaultUser.Email) {
+		t.Fatalf("unexpected auth result %q", text)
+	}
+}
@@ -0,0 +1,657 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// The HTTP transports MCP clients can connect with.
+const (
+	transportSSE        = "sse"             // /mcp/sse and /mcp/message
+	transportStreamable = "streamable-http" // /mcp
+)
+
+// httpTransports lists the transports served, by default all of them.
+var httpTransports = []string{transportSSE, transportStreamable}
+
+// streamableSessionHeader carries the session ID of the Streamable HTTP
+// transport, from the response to initialize on.
+const streamableSessionHeader = "Mcp-Session-Id"
+
+const (
+	// streamableSessionIdle is how long a session may go without requests
+	// or a listening stream before it is closed.
+	streamableSessionIdle = 30 * time.Minute
+	// streamableRetention is how long the events of a finished response
+	// stream can still be replayed.
+	streamableRetention = 5 * time.Minute
+	// streamableListenEvents is how many events of the stream started by
+	// GET are kept for replay.
+	streamableListenEvents = 100
+	// maxStreamableMessage limits the size of a POSTed message.
+	maxStreamableMessage = 4 << 20
+)
+
+// streamableServer serves MCP over the Streamable HTTP transport: clients
+// POST each JSON-RPC message to one endpoint and get the response either as
+// JSON or, when the server has notifications to send first, as an SSE
+// stream. GET opens a stream for messages outside of any request. Every SSE
+// event has an ID, and a client that lost a stream gets the rest of it by
+// reconnecting with GET and Last-Event-ID.
+//
+// mcp-go v0.29.0 has no Streamable HTTP server to build on: its
+// StreamableHTTPServer is an empty stub that only takes options.
+type streamableServer struct {
+	mcp      *server.MCPServer
+	draining atomic.Bool // new sessions are refused
+
+	mu       sync.Mutex
+	sessions map[string]*streamableSession
+}
+
+func newStreamableServer(s *server.MCPServer) *streamableServer {
+	return &streamableServer{
+		mcp:      s,
+		sessions: make(map[string]*streamableSession),
+	}
+}
+
+func (s *streamableServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.handlePost(w, r)
+	case http.MethodGet:
+		s.handleGet(w, r)
+	case http.MethodDelete:
+		s.handleDelete(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *streamableServer) handlePost(w http.ResponseWriter, r *http.Request) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxStreamableMessage))
+	if err != nil {
+		writeParseError(w, fmt.Sprintf("unable to read the message: %v", err))
+		return
+	}
+	var message struct {
+		ID     any    `json:"id"`
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal(body, &message); err != nil {
+		writeParseError(w, "the message must be a single JSON-RPC object")
+		return
+	}
+
+	var session *streamableSession
+	if message.Method == string(mcp.MethodInitialize) {
+		if s.draining.Load() {
+			w.Header().Set("Connection", "close")
+			http.Error(w, "The server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		if session, err = s.open(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(streamableSessionHeader, session.id)
+	} else if session = s.lookup(w, r); session == nil {
+		return
+	}
+	session.acquire()
+	defer session.release()
+
+	// Responses to server requests are not used, and notifications have
+	// none of their own
+	if message.Method == "" {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if message.ID == nil {
+		s.mcp.HandleMessage(s.mcp.WithContext(r.Context(), session), body)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	// Disconnecting does not cancel the request: its stream is kept for
+	// the client to resume it
+	stream := session.newStream(false)
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	stop := context.AfterFunc(session.ctx, cancel)
+	request := &streamableRequest{streamableSession: session, notifications: make(chan mcp.JSONRPCNotification, 100)}
+	end := toolCalls.begin()
+	go func() {
+		defer end()
+		defer cancel()
+		defer stop()
+		stream.run(s.mcp.WithContext(ctx, request), s.mcp, body, request.notifications)
+	}()
+
+	if !acceptsEventStream(r) {
+		stream.waitDone(r.Context())
+		events, done, _ := stream.since(0)
+		if !done || len(events) == 0 {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(events[len(events)-1].data)
+		stream.delivered(len(events))
+		return
+	}
+
+	// Answer with plain JSON unless notifications come first
+	events, done, changed := stream.since(0)
+	if len(events) == 0 && !done {
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+		events, done, _ = stream.since(0)
+	}
+	if done && len(events) == 1 {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(events[0].data)
+		stream.delivered(1)
+		return
+	}
+	session.serveStream(w, r, stream, 0)
+}
+
+func (s *streamableServer) handleGet(w http.ResponseWriter, r *http.Request) {
+	if !acceptsEventStream(r) {
+		http.Error(w, "Accept must include text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+	session := s.lookup(w, r)
+	if session == nil {
+		return
+	}
+	session.acquire()
+	defer session.release()
+
+	// Resume the stream the event came from, or the listening stream when
+	// that one is gone
+	stream, from := session.listening, -1
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		streamID, seq, ok := parseStreamEventID(lastEventID)
+		if !ok {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		if resumed := session.stream(streamID); resumed != nil {
+			stream, from = resumed, seq+1
+		}
+	}
+	if stream == session.listening {
+		if !session.listen() {
+			http.Error(w, "The session already has a listening stream", http.StatusConflict)
+			return
+		}
+		defer session.unlisten()
+	}
+	if from < 0 {
+		from = stream.firstUndelivered()
+	}
+	session.serveStream(w, r, stream, from)
+}
+
+func (s *streamableServer) handleDelete(w http.ResponseWriter, r *http.Request) {
+	session := s.lookup(w, r)
+	if session == nil {
+		return
+	}
+	s.close(r.Context(), session)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// open starts a session and registers it with the MCP server, which runs
+// the session hooks with ctx.
+func (s *streamableServer) open(ctx context.Context) (*streamableSession, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("unable to generate a session ID: %w", err)
+	}
+	session := newStreamableSession(hex.EncodeToString(id))
+	if err := s.mcp.RegisterSession(ctx, session); err != nil {
+		return nil, err
+	}
+	session.idle = time.AfterFunc(streamableSessionIdle, func() {
+		log.Printf("Closing idle MCP session %s", session.id)
+		s.close(context.Background(), session)
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.id] = session
+	return session, nil
+}
+
+// lookup returns the session named by the request's session header, or
+// answers the request and returns nil if there is none.
+func (s *streamableServer) lookup(w http.ResponseWriter, r *http.Request) *streamableSession {
+	id := r.Header.Get(streamableSessionHeader)
+	if id == "" {
+		http.Error(w, "Missing "+streamableSessionHeader+" header", http.StatusBadRequest)
+		return nil
+	}
+	s.mu.Lock()
+	session, ok := s.sessions[id]
+	s.mu.Unlock()
+	if !ok {
+		// Tells the client to initialize a new session
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return nil
+	}
+	return session
+}
+
+// drain makes the server refuse new sessions.
+func (s *streamableServer) drain() {
+	s.draining.Store(true)
+}
+
+// closeAll closes every session.
+func (s *streamableServer) closeAll(ctx context.Context) {
+	s.mu.Lock()
+	sessions := slices.Collect(maps.Values(s.sessions))
+	s.mu.Unlock()
+	for _, session := range sessions {
+		s.close(ctx, session)
+	}
+}
+
+// close ends session: its streams end, requests still running are
+// cancelled, and the session hooks run.
+func (s *streamableServer) close(ctx context.Context, session *streamableSession) {
+	s.mu.Lock()
+	_, ok := s.sessions[session.id]
+	delete(s.sessions, session.id)
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	session.idle.Stop()
+	session.cancel()
+	s.mcp.UnregisterSession(ctx, session.id)
+}
+
+// streamableSession is a Streamable HTTP session, registered with the MCP
+// server for as long as it lasts. Notifications sent to it outside of a
+// request go to its listening stream.
+type streamableSession struct {
+	id            string
+	notifications chan mcp.JSONRPCNotification
+	initialized   atomic.Bool
+	logLevel      atomic.Value
+	ctx           context.Context // done once the session is closed
+	cancel        context.CancelFunc
+	listening     *sseStream
+	idle          *time.Timer
+
+	mu         sync.Mutex
+	streams    map[int]*sseStream
+	nextStream int
+	active     int  // requests being served
+	listener   bool // whether a GET serves the listening stream
+}
+
+func newStreamableSession(id string) *streamableSession {
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &streamableSession{
+		id:            id,
+		notifications: make(chan mcp.JSONRPCNotification, 100),
+		ctx:           ctx,
+		cancel:        cancel,
+		streams:       make(map[int]*sseStream),
+	}
+	session.listening = session.newStream(true)
+	go func() {
+		for {
+			select {
+			case notification := <-session.notifications:
+				session.listening.append(notification)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return session
+}
+
+func (s *streamableSession) SessionID() string {
+	return s.id
+}
+
+func (s *streamableSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func (s *streamableSession) Initialize() {
+	s.initialized.Store(true)
+}
+
+func (s *streamableSession) Initialized() bool {
+	return s.initialized.Load()
+}
+
+func (s *streamableSession) SetLogLevel(level mcp.LoggingLevel) {
+	s.logLevel.Store(level)
+}
+
+func (s *streamableSession) GetLogLevel() mcp.LoggingLevel {
+	if level, ok := s.logLevel.Load().(mcp.LoggingLevel); ok {
+		return level
+	}
+	return mcp.LoggingLevelError
+}
+
+var _ server.SessionWithLogging = (*streamableSession)(nil)
+
+// acquire marks the session busy until release, so it is not closed for
+// being idle meanwhile.
+func (s *streamableSession) acquire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active++
+	s.idle.Stop()
+}
+
+func (s *streamableSession) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active--
+	if s.active == 0 {
+		s.idle.Reset(streamableSessionIdle)
+	}
+}
+
+// listen claims the listening stream, which one GET at a time may serve.
+func (s *streamableSession) listen() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener {
+		return false
+	}
+	s.listener = true
+	return true
+}
+
+func (s *streamableSession) unlisten() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listener = false
+}
+
+// newStream starts a stream of the session, dropping response streams that
+// finished more than streamableRetention ago.
+func (s *streamableSession) newStream(listening bool) *sseStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, stream := range s.streams {
+		if stream.expired(time.Now()) {
+			delete(s.streams, id)
+		}
+	}
+	stream := &sseStream{id: s.nextStream, changed: make(chan struct{})}
+	if listening {
+		stream.limit = streamableListenEvents
+	}
+	s.streams[stream.id] = stream
+	s.nextStream++
+	return stream
+}
+
+func (s *streamableSession) stream(id int) *sseStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streams[id]
+}
+
+// serveStream writes the events of stream from sequence number from on as
+// SSE, until the stream finishes, the client disconnects, or the session
+// closes.
+func (s *streamableSession) serveStream(w http.ResponseWriter, r *http.Request, stream *sseStream, from int) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// write sends the events from from on and reports whether the stream
+	// is done
+	write := func() (bool, <-chan struct{}) {
+		events, done, changed := stream.since(from)
+		for _, event := range events {
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: message\ndata: %s\n\n", event.id, event.data); err != nil {
+				return true, nil
+			}
+		}
+		flusher.Flush()
+		// Events dropped meanwhile are skipped, so count from the last one
+		if len(events) > 0 {
+			from = events[len(events)-1].number + 1
+		}
+		stream.delivered(from)
+		return done, changed
+	}
+	for {
+		done, changed := write()
+		if done {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		case <-s.ctx.Done():
+			// Whatever came in meanwhile still goes out
+			write()
+			return
+		}
+	}
+}
+
+// streamableRequest is the session as one POSTed request sees it:
+// notifications sent while handling the request go to the request's
+// stream, ahead of its response.
+type streamableRequest struct {
+	*streamableSession
+	notifications chan mcp.JSONRPCNotification
+}
+
+func (r *streamableRequest) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return r.notifications
+}
+
+// sseStream is a sequence of SSE events kept for replay. Events are
+// numbered from 0 and identified as "<stream>-<number>".
+type sseStream struct {
+	id    int
+	limit int // how many events are kept, or 0 for all of them
+
+	mu      sync.Mutex
+	events  []sseEvent
+	first   int // number of events[0]
+	sent    int // number of the first event not delivered yet
+	done    bool
+	doneAt  time.Time
+	changed chan struct{} // closed and replaced on every change
+}
+
+type sseEvent struct {
+	number int
+	id     string
+	data   []byte
+}
+
+// run handles the request message and appends the notifications sent
+// meanwhile, and then its response, to the stream.
+func (s *sseStream) run(ctx context.Context, mcpServer *server.MCPServer, message []byte, notifications chan mcp.JSONRPCNotification) {
+	response := make(chan mcp.JSONRPCMessage, 1)
+	go func() {
+		response <- mcpServer.HandleMessage(ctx, message)
+	}()
+	for {
+		select {
+		case notification := <-notifications:
+			s.append(notification)
+		case message := <-response:
+			for len(notifications) > 0 {
+				s.append(<-notifications)
+			}
+			s.finish(message)
+			return
+		}
+	}
+}
+
+func (s *sseStream) append(message any) {
+	s.add(message, false)
+}
+
+// finish appends the final message of the stream.
+func (s *sseStream) finish(message any) {
+	s.add(message, true)
+}
+
+func (s *sseStream) add(message any, last bool) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Unable to encode MCP message: %v", err)
+		data = nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if data != nil {
+		number := s.first + len(s.events)
+		s.events = append(s.events, sseEvent{number: number, id: fmt.Sprintf("%d-%d", s.id, number), data: data})
+		if s.limit > 0 && len(s.events) > s.limit {
+			s.events = s.events[1:]
+			s.first++
+		}
+	}
+	if last {
+		s.done, s.doneAt = true, time.Now()
+	}
+	s.notify()
+}
+
+func (s *sseStream) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// since returns the events numbered from on that are still kept, whether
+// the stream is done, and a channel closed once that changes.
+func (s *sseStream) since(from int) ([]sseEvent, bool, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	from = max(from-s.first, 0)
+	if from > len(s.events) {
+		from = len(s.events)
+	}
+	events := s.events[from:]
+	return events[:len(events):len(events)], s.done, s.changed
+}
+
+// waitDone waits until the stream is done or ctx is.
+func (s *sseStream) waitDone(ctx context.Context) {
+	for {
+		_, done, changed := s.since(0)
+		if done {
+			return
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// delivered records that the events before number to have been written to
+// a client.
+func (s *sseStream) delivered(to int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = max(s.sent, to)
+}
+
+// firstUndelivered is the number of the first event no client was sent.
+func (s *sseStream) firstUndelivered() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sent
+}
+
+// expired reports whether the stream finished more than
+// streamableRetention before now.
+func (s *sseStream) expired(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done && now.Sub(s.doneAt) > streamableRetention
+}
+
+// parseStreamEventID splits an SSE event ID into its stream and number.
+func parseStreamEventID(id string) (int, int, bool) {
+	streamPart, numberPart, ok := strings.Cut(id, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	stream, err := strconv.Atoi(streamPart)
+	if err != nil || stream < 0 {
+		return 0, 0, false
+	}
+	number, err := strconv.Atoi(numberPart)
+	if err != nil || number < 0 {
+		return 0, 0, false
+	}
+	return stream, number, true
+}
+
+// acceptsEventStream reports whether the client accepts SSE responses.
+func acceptsEventStream(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(accept))
+		if mediaType == "text/event-stream" || mediaType == "*/*" || mediaType == "text/*" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeParseError answers a message that could not be parsed.
+func writeParseError(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(mcp.NewJSONRPCError(mcp.NewRequestId(nil), mcp.PARSE_ERROR, message, nil))
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google-calendar-mcp/fakegoogle"
+)
+
+func TestE2EStreamableHTTPTools(t *testing.T) {
+	env := newTestEnvOver(t, transportStreamable)
+	env.fake.AddCalendar(fakegoogle.DefaultUser.Email, "team@example.com", "Team")
+
+	if text, isError := env.call("list_calendars", map[string]any{}); !isError || text != TOOL_ERROR_AUTHENTICATION_REQUIRED {
+		t.Fatalf("expected authentication required, got %q", text)
+	}
+	// The consent URL arrives on the stream of the auth call
+	if text := env.authenticate(); !strings.Contains(text, "Authenticated as "+fakegoogle.DefaultUser.Email) {
+		t.Fatalf("unexpected auth result %q", text)
+	}
+	text, _ := env.call("list_calendars", map[string]any{})
+	if !strings.Contains(text, "Team (ID: team@example.com)") {
+		t.Fatalf("expected the Team calendar, got %q", text)
+	}
+}
+
+// streamableClient speaks the Streamable HTTP transport by hand, to see
+// the SSE events themselves.
+type streamableClient struct {
+	t       *testing.T
+	url     string
+	session string
+	nextID  int
+}
+
+// post sends message, adding an ID unless it is a notification, and returns
+// the response.
+func (c *streamableClient) post(message map[string]any) *http.Response {
+	c.t.Helper()
+	message["jsonrpc"] = "2.0"
+	if !strings.HasPrefix(message["method"].(string), "notifications/") {
+		c.nextID++
+		message["id"] = c.nextID
+	}
+	body, _ := json.Marshal(message)
+	req, _ := http.NewRequest(http.MethodPost, c.url, strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if c.session != "" {
+		req.Header.Set(streamableSessionHeader, c.session)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return resp
+}
+
+// get opens an SSE stream, resuming after lastEventID unless it is empty.
+func (c *streamableClient) get(lastEventID string) *http.Response {
+	c.t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, c.url, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set(streamableSessionHeader, c.session)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		c.t.Fatalf("GET: %s", resp.Status)
+	}
+	return resp
+}
+
+type testSSEEvent struct {
+	ID      string
+	Message map[string]any
+}
+
+// readEvent returns the next event of an SSE stream, or false at its end.
+func readEvent(t *testing.T, r *bufio.Reader) (testSSEEvent, bool) {
+	t.Helper()
+	var event testSSEEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			return event, false
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "" && event.Message != nil:
+			return event, true
+		case strings.HasPrefix(line, "id: "):
+			event.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.Message); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestStreamableHTTPResumesStreams(t *testing.T) {
+	env := newTestEnvOver(t, transportStreamable)
+	c := &streamableClient{t: t, url: env.url + "/mcp"}
+
+	if resp := c.post(map[string]any{"method": "tools/list"}); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a request without session to fail, got %s", resp.Status)
+	}
+	resp := c.post(map[string]any{"method": "initialize", "params": map[string]any{
+		"protocolVersion": "2025-03-26",
+		"clientInfo":      map[string]any{"name": "raw", "version": "0.0.0"},
+	}})
+	resp.Body.Close()
+	c.session = resp.Header.Get(streamableSessionHeader)
+	if resp.StatusCode != http.StatusOK || c.session == "" {
+		t.Fatalf("initialize: %s, session %q", resp.Status, c.session)
+	}
+	if resp := c.post(map[string]any{"method": "notifications/initialized"}); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("notifications/initialized: %s", resp.Status)
+	}
+
+	// Without notifications to send first, the response is plain JSON
+	resp = c.post(map[string]any{"method": "tools/call", "params": map[string]any{"name": "list_calendars", "arguments": map[string]any{}}})
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "application/json" || !strings.Contains(string(body), TOOL_ERROR_AUTHENTICATION_REQUIRED) {
+		t.Fatalf("list_calendars: %s %s", resp.Header.Get("Content-Type"), body)
+	}
+
+	// The auth call streams the consent URL; drop the connection after it
+	resp = c.post(map[string]any{"method": "tools/call", "params": map[string]any{"name": "auth", "arguments": map[string]any{}}})
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("auth: expected an SSE stream, got %s", resp.Header.Get("Content-Type"))
+	}
+	first, ok := readEvent(t, bufio.NewReader(resp.Body))
+	resp.Body.Close()
+	if !ok || first.Message["method"] != "notifications/message" || first.ID == "" {
+		t.Fatalf("auth: unexpected first event %+v", first)
+	}
+	env.consent(fmt.Sprint(first.Message["params"].(map[string]any)["data"]))
+
+	// Resuming gets the rest of the stream, up to the call's result
+	resp = c.get(first.ID)
+	stream := bufio.NewReader(resp.Body)
+	var result string
+	for {
+		event, ok := readEvent(t, stream)
+		if !ok {
+			break
+		}
+		if event.ID == first.ID {
+			t.Fatalf("event %s replayed again", event.ID)
+		}
+		if event.Message["id"] != nil {
+			result = fmt.Sprint(event.Message["result"])
+		}
+	}
+	resp.Body.Close()
+	if !strings.Contains(result, "Authenticated as "+fakegoogle.DefaultUser.Email) {
+		t.Fatalf("expected the resumed stream to end with the auth result, got %q", result)
+	}
+
+	// Notifications outside of requests wait on the listening stream
+	resp = c.get("")
+	stream = bufio.NewReader(resp.Body)
+	for {
+		event, ok := readEvent(t, stream)
+		if !ok {
+			t.Fatal("expected the resumed list_calendars call on the listening stream")
+		}
+		if event.Message["method"] == resumedToolCallMethod {
+			break
+		}
+	}
+	resp.Body.Close()
+
+	req, _ := http.NewRequest(http.MethodDelete, c.url, nil)
+	req.Header.Set(streamableSessionHeader, c.session)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE: %v %v", resp, err)
+	}
+	if resp := c.post(map[string]any{"method": "tools/list"}); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected the deleted session to be gone, got %s", resp.Status)
+	}
+}
+
+func TestServeStreamAfterDroppedEvents(t *testing.T) {
+	stream := &sseStream{limit: 2, changed: make(chan struct{})}
+	for i := range 4 {
+		stream.append(map[string]any{"method": fmt.Sprint(i)})
+	}
+	session := &streamableSession{ctx: context.Background()}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session.serveStream(w, r, stream, 0)
+	}))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	events := bufio.NewReader(resp.Body)
+	var ids []string
+	for len(ids) < 2 {
+		event, ok := readEvent(t, events)
+		if !ok {
+			t.Fatal("stream ended early")
+		}
+		ids = append(ids, event.ID)
+	}
+	// The stream goes on after the last event sent, not after as many
+	// events as were sent
+	stream.finish(map[string]any{"method": "4"})
+	for {
+		event, ok := readEvent(t, events)
+		if !ok {
+			break
+		}
+		ids = append(ids, event.ID)
+	}
+	if got := strings.Join(ids, " "); got != "0-2 0-3 0-4" {
+		t.Fatalf("expected events 0-2 0-3 0-4, got %s", got)
+	}
+}
+
+func TestParseStreamEventID(t *testing.T) {
+	for id, want := range map[string][2]int{"0-0": {0, 0}, "3-17": {3, 17}} {
+		stream, number, ok := parseStreamEventID(id)
+		if !ok || stream != want[0] || number != want[1] {
+			t.Errorf("parseStreamEventID(%q) = %d, %d, %v", id, stream, number, ok)
+		}
+	}
+	for _, id := range []string{"", "3", "a-1", "1-b", "-1-2"} {
+		if _, _, ok := parseStreamEventID(id); ok {
+			t.Errorf("parseStreamEventID(%q) succeeded", id)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// storedAccount is the persisted form of a linked account.
+type storedAccount struct {
+	ID     string   `json:"id"`
+	Email  string   `json:"email"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// Principals are the bearer identities bound to the account.
+	Principals []string      `json:"principals,omitempty"`
+	Token      *oauth2.Token `json:"token"`
+}
+
+// TokenStore persists the OAuth tokens of linked accounts so they survive
+// server restarts.
+type TokenStore interface {
+	// Save creates or replaces the record with the same ID.
+	Save(record *storedAccount) error
+	// Delete removes the record with the given ID, if any.
+	Delete(id string) error
+	// LoadAll returns every stored record.
+	LoadAll() ([]*storedAccount, error)
+}
+
+// fileTokenStore keeps all records in a single file encrypted with
+// AES-256-GCM. The file is rewritten atomically on every change.
+type fileTokenStore struct {
+	mu   sync.Mutex
+	path string
+	aead cipher.AEAD
+}
+
+// newFileTokenStore opens the store at path. key must be 32 bytes.
+func newFileTokenStore(path string, key []byte) (*fileTokenStore, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("token store key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &fileTokenStore{path: path, aead: aead}, nil
+}
+
+// newTokenStoreFromConfig configures persistence from the token store path
+// and key (base64, 32 bytes). Without a path tokens are kept in memory only;
+// a path without a key is refused rather than written in clear.
+func newTokenStoreFromConfig(path, encodedKey string) (TokenStore, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if encodedKey == "" {
+		return nil, fmt.Errorf("TOKEN_STORE_KEY is required when TOKEN_STORE_PATH is set")
+	}
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("TOKEN_STORE_KEY is not valid base64: %w", err)
+	}
+	return newFileTokenStore(path, key)
+}
+
+func (s *fileTokenStore) Save(record *storedAccount) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records, err := s.read()
+	if err != nil {
+		return err
+	}
+	records[record.ID] = record
+	return s.write(records)
+}
+
+func (s *fileTokenStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := records[id]; !ok {
+		return nil
+	}
+	delete(records, id)
+	return s.write(records)
+}
+
+func (s *fileTokenStore) LoadAll() ([]*storedAccount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	all := make([]*storedAccount, 0, len(records))
+	for _, record := range records {
+		all = append(all, record)
+	}
+	return all, nil
+}
+
+func (s *fileTokenStore) read() (map[string]*storedAccount, error) {
+	records := make(map[string]*storedAccount)
+	sealed, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := s.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, fmt.Errorf("token store %s is corrupt", s.path)
+	}
+	plaintext, err := s.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt token store %s (wrong key?): %w", s.path, err)
+	}
+	if err := json.Unmarshal(plaintext, &records); err != nil {
+		return nil, fmt.Errorf("token store %s is corrupt: %w", s.path, err)
+	}
+	return records, nil
+}
+
+func (s *fileTokenStore) write(records map[string]*storedAccount) error {
+	plaintext, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := s.aead.Seal(nonce, nonce, plaintext, nil)
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".tokens-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(sealed); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
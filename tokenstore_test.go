@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestFileTokenStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.enc")
+	key := bytes.Repeat([]byte{7}, 32)
+
+	store, err := newFileTokenStore(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := &storedAccount{
+		ID:    "alice",
+		Email: "alice@example.com",
+		Token: &oauth2.Token{AccessToken: "access", RefreshToken: "very-secret-refresh-token"},
+	}
+	if err := store.Save(record); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(&storedAccount{ID: "bob", Token: &oauth2.Token{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("very-secret-refresh-token")) {
+		t.Fatal("refresh token stored in clear text")
+	}
+
+	// A fresh store with the same key sees what the first one wrote
+	reopened, err := newFileTokenStore(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Delete("bob"); err != nil {
+		t.Fatal(err)
+	}
+	records, err := reopened.LoadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Email != "alice@example.com" || records[0].Token.RefreshToken != "very-secret-refresh-token" {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+
+	wrongKey, err := newFileTokenStore(path, bytes.Repeat([]byte{8}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wrongKey.LoadAll(); err == nil {
+		t.Fatal("expected decryption to fail with the wrong key")
+	}
+}
+
+func TestFileTokenStoreRejectsShortKey(t *testing.T) {
+	if _, err := newFileTokenStore(filepath.Join(t.TempDir(), "tokens.enc"), []byte("short")); err == nil {
+		t.Fatal("expected error for short key")
+	}
+}